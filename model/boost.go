@@ -0,0 +1,67 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Timestamped is implemented by feed data that knows when it was created. It
+// is optional: freshness decay (see Scoring) leaves other feeds alone.
+type Timestamped interface {
+	GetCreatedAt() time.Time
+}
+
+// Boostable is implemented by feed data that carries a boost of its own, a
+// factor its score is multiplied by. It is optional.
+type Boostable interface {
+	GetBoost() float64
+}
+
+// Scoring configures how the score a feed is ranked by is derived from
+// Score().
+type Scoring struct {
+	// HalfLife is the age at which the score of a Timestamped feed is halved.
+	// Zero disables freshness decay.
+	HalfLife time.Duration `json:"half_life,omitempty"`
+}
+
+// Decay returns the freshness factor of a feed created at createdAt, as of
+// now. Feeds from the future are not boosted.
+func (s Scoring) Decay(createdAt, now time.Time) float64 {
+	if s.HalfLife <= 0 || createdAt.IsZero() {
+		return 1
+	}
+	age := now.Sub(createdAt)
+	if age <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(age)/float64(s.HalfLife))
+}
+
+// Boost is a feed_boost row: a factor the score of one feed (FeedId) or of
+// every feed of a type (FeedType) is multiplied by, until ExpiresAt. Exactly
+// one of FeedId and FeedType is set. A feed and its type boosts both apply.
+type Boost struct {
+	FeedId    string     `json:"id,omitempty" db:"feed_id"`
+	FeedType  FeedType   `json:"type,omitempty" db:"feed_type"`
+	Factor    float64    `json:"factor" db:"factor"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+}
+
+// Validate reports whether b can be stored.
+func (b Boost) Validate() error {
+	if (b.FeedId == "") == (b.FeedType == "") {
+		return errors.New("boost must target either a feed or a feed type")
+	}
+	if b.Factor < 0 || math.IsNaN(b.Factor) || math.IsInf(b.Factor, 0) {
+		return fmt.Errorf("invalid boost factor %v", b.Factor)
+	}
+	return nil
+}
+
+// Active reports whether b applies at now.
+func (b Boost) Active(now time.Time) bool {
+	return b.ExpiresAt == nil || now.Before(*b.ExpiresAt)
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScoringDecay(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		halfLife  time.Duration
+		createdAt time.Time
+		expected  float64
+	}{
+		{name: "no half-life", halfLife: 0, createdAt: now.Add(-48 * time.Hour), expected: 1},
+		{name: "new", halfLife: 24 * time.Hour, createdAt: now, expected: 1},
+		{name: "one half-life", halfLife: 24 * time.Hour, createdAt: now.Add(-24 * time.Hour), expected: 0.5},
+		{name: "two half-lives", halfLife: 24 * time.Hour, createdAt: now.Add(-48 * time.Hour), expected: 0.25},
+		{name: "from the future", halfLife: 24 * time.Hour, createdAt: now.Add(time.Hour), expected: 1},
+		{name: "unknown creation time", halfLife: 24 * time.Hour, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Scoring{HalfLife: tt.halfLife}.Decay(tt.createdAt, now)
+			if math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBoostValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		boost   Boost
+		wantErr bool
+	}{
+		{name: "feed boost", boost: Boost{FeedId: "feed1", Factor: 2}},
+		{name: "type boost", boost: Boost{FeedType: TypeChat, Factor: 0}},
+		{name: "no target", boost: Boost{Factor: 2}, wantErr: true},
+		{name: "both targets", boost: Boost{FeedId: "feed1", FeedType: TypeChat, Factor: 2}, wantErr: true},
+		{name: "negative factor", boost: Boost{FeedId: "feed1", Factor: -1}, wantErr: true},
+		{name: "infinite factor", boost: Boost{FeedId: "feed1", Factor: math.Inf(1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.boost.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBoostActive(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+
+	if !(Boost{}).Active(now) {
+		t.Error("expected a boost without expiry to be active")
+	}
+	if !(Boost{ExpiresAt: &later}).Active(now) {
+		t.Error("expected a boost expiring later to be active")
+	}
+	if (Boost{ExpiresAt: &earlier}).Active(now) {
+		t.Error("expected an expired boost to be inactive")
+	}
+	if (Boost{ExpiresAt: &now}).Active(now) {
+		t.Error("expected a boost to expire at ExpiresAt")
+	}
+}
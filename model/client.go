@@ -0,0 +1,99 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CLIENT_KEY optionally carries the Client making the request. The platform,
+// minversion and maxversion policies are evaluated against it; when it is
+// absent those policies do not take effect, the same way other policies behave
+// when the data they depend on cannot be resolved.
+const CLIENT_KEY contextKey = "client"
+
+// Client describes the app build a feed is served to.
+type Client struct {
+	Platform string `json:"platform"` // e.g. "ios", "android", "web"; matched case-insensitively
+	Version  string `json:"version"`  // semantic version, e.g. "5.2.0" or "v5.2"
+}
+
+// ClientFromContext returns the Client carried in ctx under CLIENT_KEY.
+func ClientFromContext(ctx context.Context) (Client, bool) {
+	switch client := ctx.Value(CLIENT_KEY).(type) {
+	case Client:
+		return client, true
+	case *Client:
+		if client != nil {
+			return *client, true
+		}
+	}
+	return Client{}, false
+}
+
+// CompareVersions compares two semantic versions and returns -1, 0 or 1 when a
+// is lower than, equal to or greater than b. A leading "v" is ignored and
+// missing components count as zero, so "5.2" equals "5.2.0". A pre-release
+// ("5.2.0-beta") sorts before its release, and pre-releases of the same core
+// compare lexically.
+func CompareVersions(a, b string) (int, error) {
+	coreA, preA, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	coreB, preB, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < len(coreA) || i < len(coreB); i++ {
+		var x, y int64
+		if i < len(coreA) {
+			x = coreA[i]
+		}
+		if i < len(coreB) {
+			y = coreB[i]
+		}
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return 0, nil
+	case preA == "":
+		return 1, nil
+	case preB == "":
+		return -1, nil
+	case preA < preB:
+		return -1, nil
+	default:
+		return 1, nil
+	}
+}
+
+func parseVersion(v string) ([]int64, string, error) {
+	v = strings.TrimPrefix(strings.TrimSpace(strings.ToLower(v)), "v")
+	if v == "" {
+		return nil, "", fmt.Errorf("empty version")
+	}
+	// build metadata never affects precedence
+	v, _, _ = strings.Cut(v, "+")
+	core, pre, _ := strings.Cut(v, "-")
+
+	parts := strings.Split(core, ".")
+	numbers := make([]int64, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return nil, "", fmt.Errorf("invalid version %q", v)
+		}
+		numbers[i] = n
+	}
+	return numbers, pre, nil
+}
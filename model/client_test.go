@@ -0,0 +1,107 @@
+package model
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		name          string
+		a             string
+		b             string
+		expected      int
+		expectedError bool
+	}{
+		{name: "equal", a: "5.2.0", b: "5.2.0", expected: 0},
+		{name: "missing patch counts as zero", a: "5.2", b: "5.2.0", expected: 0},
+		{name: "leading v is ignored", a: "v5.2.1", b: "5.2.1", expected: 0},
+		{name: "minor is numeric not lexical", a: "5.10.0", b: "5.9.0", expected: 1},
+		{name: "major lower", a: "4.99.99", b: "5.0", expected: -1},
+		{name: "pre-release sorts before release", a: "5.2.0-beta", b: "5.2.0", expected: -1},
+		{name: "release sorts after pre-release", a: "5.2.0", b: "5.2.0-rc1", expected: 1},
+		{name: "pre-releases compare lexically", a: "5.2.0-alpha", b: "5.2.0-beta", expected: -1},
+		{name: "build metadata ignored", a: "5.2.0+1234", b: "5.2.0", expected: 0},
+		{name: "empty version", a: "", b: "5.2.0", expectedError: true},
+		{name: "non numeric component", a: "5.x", b: "5.2.0", expectedError: true},
+		{name: "invalid right hand side", a: "5.2.0", b: "latest", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CompareVersions(tt.a, tt.b)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("CompareVersions(%q, %q) = %d, expected %d", tt.a, tt.b, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientFromContext(t *testing.T) {
+	t.Run("value", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), CLIENT_KEY, Client{Platform: "ios", Version: "5.2.0"})
+		client, ok := ClientFromContext(ctx)
+		if !ok || client.Platform != "ios" || client.Version != "5.2.0" {
+			t.Errorf("unexpected client %+v (ok=%v)", client, ok)
+		}
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), CLIENT_KEY, &Client{Platform: "android"})
+		client, ok := ClientFromContext(ctx)
+		if !ok || client.Platform != "android" {
+			t.Errorf("unexpected client %+v (ok=%v)", client, ok)
+		}
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		if _, ok := ClientFromContext(context.Background()); ok {
+			t.Error("expected no client")
+		}
+	})
+}
+
+func TestPolicyTypeViolatedClient(t *testing.T) {
+	ios52 := Client{Platform: "iOS", Version: "5.2.0"}
+
+	tests := []struct {
+		name             string
+		policy           PolicyType
+		client           *Client
+		expectedViolated bool
+	}{
+		{name: "platform matches case-insensitively", policy: "platform:ios", client: &ios52, expectedViolated: false},
+		{name: "platform mismatch (violation)", policy: "platform:android", client: &ios52, expectedViolated: true},
+		{name: "platform alternatives are ORed", policy: "platform:android:ios", client: &ios52, expectedViolated: false},
+		{name: "platform without client", policy: "platform:ios", client: nil, expectedViolated: false},
+		{name: "minversion satisfied", policy: "minversion:5.2", client: &ios52, expectedViolated: false},
+		{name: "minversion not met (violation)", policy: "minversion:5.3.0", client: &ios52, expectedViolated: true},
+		{name: "maxversion satisfied", policy: "maxversion:5.2.0", client: &ios52, expectedViolated: false},
+		{name: "maxversion exceeded (violation)", policy: "maxversion:5.1.9", client: &ios52, expectedViolated: true},
+		{name: "minversion without client", policy: "minversion:5.2.0", client: nil, expectedViolated: false},
+		{name: "minversion with unknown client version", policy: "minversion:5.2.0", client: &Client{Platform: "ios"}, expectedViolated: false},
+		{name: "minversion with invalid param", policy: "minversion:latest", client: &ios52, expectedViolated: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.client != nil {
+				ctx = context.WithValue(ctx, CLIENT_KEY, *tt.client)
+			}
+			result := tt.policy.Violated(ctx, "user1", "post1", &mockPolicyResolver{})
+			if result != tt.expectedViolated {
+				t.Errorf("expected violated=%v, got %v", tt.expectedViolated, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package model
+
+// Diversity constrains how feeds of the same type are interleaved once they
+// are sorted by score. A zero or negative value sets no constraint.
+type Diversity struct {
+	// MaxConsecutive is the longest run of feeds of one type.
+	MaxConsecutive int `json:"max_consecutive,omitempty"`
+	// MinGap is, per type, how many feeds of other types must at least
+	// separate two feeds of that type.
+	MinGap map[FeedType]int `json:"min_gap,omitempty"`
+	// Quotas is, per type, how many feeds of that type the first Window feeds
+	// hold at most.
+	Quotas map[FeedType]int `json:"quotas,omitempty"`
+	Window int              `json:"window,omitempty"`
+}
+
+// Enabled reports whether d sets any constraint.
+func (d Diversity) Enabled() bool {
+	if d.MaxConsecutive > 0 {
+		return true
+	}
+	for _, gap := range d.MinGap {
+		if gap > 0 {
+			return true
+		}
+	}
+	if d.Window > 0 {
+		for _, quota := range d.Quotas {
+			if quota > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Diversify returns the feeds reordered to honour d. It walks the list and
+// takes, at each index, the highest ranked remaining feed that breaks no
+// constraint; when every remaining feed would break one, it takes the highest
+// ranked anyway, so no feed is ever dropped. The order within a type is kept.
+func (f Feeds[T]) Diversify(d Diversity) Feeds[T] {
+	if !d.Enabled() || len(f) < 2 {
+		return f
+	}
+
+	remaining := append(Feeds[T]{}, f...)
+	out := make(Feeds[T], 0, len(f))
+	lastIndex := make(map[FeedType]int)
+	counts := make(map[FeedType]int)
+	run := 0
+
+	allowed := func(t FeedType) bool {
+		i := len(out)
+		if d.MaxConsecutive > 0 && i > 0 && out[i-1].Type == t && run >= d.MaxConsecutive {
+			return false
+		}
+		if gap := d.MinGap[t]; gap > 0 {
+			if last, ok := lastIndex[t]; ok && i-last-1 < gap {
+				return false
+			}
+		}
+		if quota := d.Quotas[t]; quota > 0 && i < d.Window && counts[t] >= quota {
+			return false
+		}
+		return true
+	}
+
+	for len(remaining) > 0 {
+		pick := 0
+		for j := range remaining {
+			if allowed(remaining[j].Type) {
+				pick = j
+				break
+			}
+		}
+		feed := remaining[pick]
+		remaining = append(remaining[:pick], remaining[pick+1:]...)
+
+		i := len(out)
+		if i > 0 && out[i-1].Type == feed.Type {
+			run++
+		} else {
+			run = 1
+		}
+		lastIndex[feed.Type] = i
+		if i < d.Window {
+			counts[feed.Type]++
+		}
+		out = append(out, feed)
+	}
+	return out
+}
+
+// CapPerKey returns the feeds reordered so that the first top feeds hold at
+// most perKey feeds of each key (see Keyed). The feeds over the cap are moved
+// right after the first top, in their order; none is dropped.
+func (f Feeds[T]) CapPerKey(perKey, top int) Feeds[T] {
+	if perKey <= 0 || top <= 0 || len(f) <= perKey {
+		return f
+	}
+
+	out := make(Feeds[T], 0, len(f))
+	var deferred Feeds[T]
+	counts := make(map[string]int)
+	i := 0
+	for ; i < len(f) && len(out) < top; i++ {
+		if keyed, ok := any(f[i].Data).(Keyed); ok {
+			if key := keyed.GetKey(); key != "" {
+				if counts[key] >= perKey {
+					deferred = append(deferred, f[i])
+					continue
+				}
+				counts[key]++
+			}
+		}
+		out = append(out, f[i])
+	}
+	out = append(out, deferred...)
+	return append(out, f[i:]...)
+}
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+// typedFeeds builds feeds in the given order from "id:type" pairs.
+func typedFeeds(specs ...string) Feeds[MockPost] {
+	feeds := make(Feeds[MockPost], len(specs))
+	for i, spec := range specs {
+		id, t, _ := strings.Cut(spec, ":")
+		feeds[i] = Feed[MockPost]{
+			ID:   id,
+			Type: FeedType(t),
+			Data: MockPost{id: id, feedType: FeedType(t), score: float64(len(specs) - i)},
+		}
+	}
+	return feeds
+}
+
+func TestFeedsDiversify(t *testing.T) {
+	tests := []struct {
+		name      string
+		feeds     Feeds[MockPost]
+		diversity Diversity
+		expected  []string
+	}{
+		{
+			name:      "no constraint keeps the order",
+			feeds:     typedFeeds("c1:chat", "c2:chat", "c3:chat", "p1:post"),
+			diversity: Diversity{MinGap: map[FeedType]int{TypeChat: 0}},
+			expected:  []string{"c1", "c2", "c3", "p1"},
+		},
+		{
+			name:      "max consecutive breaks runs",
+			feeds:     typedFeeds("c1:chat", "c2:chat", "c3:chat", "c4:chat", "p1:post", "p2:post"),
+			diversity: Diversity{MaxConsecutive: 2},
+			expected:  []string{"c1", "c2", "p1", "c3", "c4", "p2"},
+		},
+		{
+			name:      "max consecutive gives up when only one type is left",
+			feeds:     typedFeeds("c1:chat", "p1:post", "c2:chat", "c3:chat", "c4:chat"),
+			diversity: Diversity{MaxConsecutive: 1},
+			expected:  []string{"c1", "p1", "c2", "c3", "c4"},
+		},
+		{
+			name:      "min gap spaces a type out",
+			feeds:     typedFeeds("c1:chat", "c2:chat", "p1:post", "p2:post", "p3:post", "c3:chat"),
+			diversity: Diversity{MinGap: map[FeedType]int{TypeChat: 2}},
+			expected:  []string{"c1", "p1", "p2", "c2", "p3", "c3"},
+		},
+		{
+			name:      "min gap only applies to its type",
+			feeds:     typedFeeds("p1:post", "p2:post", "c1:chat", "c2:chat"),
+			diversity: Diversity{MinGap: map[FeedType]int{TypeChat: 1}},
+			expected:  []string{"p1", "p2", "c1", "c2"},
+		},
+		{
+			name:      "quota caps a type within the window",
+			feeds:     typedFeeds("c1:chat", "c2:chat", "c3:chat", "p1:post", "p2:post", "p3:post"),
+			diversity: Diversity{Quotas: map[FeedType]int{TypeChat: 1}, Window: 4},
+			expected:  []string{"c1", "p1", "p2", "p3", "c2", "c3"},
+		},
+		{
+			name:      "quota without a window sets no constraint",
+			feeds:     typedFeeds("c1:chat", "c2:chat", "p1:post"),
+			diversity: Diversity{Quotas: map[FeedType]int{TypeChat: 1}},
+			expected:  []string{"c1", "c2", "p1"},
+		},
+		{
+			name:  "rules combine",
+			feeds: typedFeeds("c1:chat", "c2:chat", "b1:banners", "b2:banners", "p1:post", "p2:post", "p3:post"),
+			diversity: Diversity{
+				MaxConsecutive: 1,
+				MinGap:         map[FeedType]int{TypeBanners: 3},
+				Quotas:         map[FeedType]int{TypeChat: 1},
+				Window:         3,
+			},
+			expected: []string{"c1", "b1", "p1", "c2", "p2", "b2", "p3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := append(Feeds[MockPost]{}, tt.feeds...)
+			got := tt.feeds.Diversify(tt.diversity)
+
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %d feeds, got %d", len(tt.expected), len(got))
+			}
+			for i, id := range tt.expected {
+				if got[i].ID != id {
+					t.Fatalf("expected %v at index %d, got %v", id, i, got[i].ID)
+				}
+			}
+			for i := range input {
+				if tt.feeds[i].ID != input[i].ID {
+					t.Fatal("expected the input to be left untouched")
+				}
+			}
+		})
+	}
+}
+
+type keyedPost struct {
+	MockPost
+	key string
+}
+
+func (k keyedPost) GetKey() string {
+	return k.key
+}
+
+// keyedFeeds builds feeds in the given order from "id:key" pairs.
+func keyedFeeds(specs ...string) Feeds[keyedPost] {
+	feeds := make(Feeds[keyedPost], len(specs))
+	for i, spec := range specs {
+		id, key, _ := strings.Cut(spec, ":")
+		feeds[i] = Feed[keyedPost]{
+			ID:   id,
+			Type: TypePost,
+			Data: keyedPost{MockPost: MockPost{id: id, feedType: TypePost}, key: key},
+		}
+	}
+	return feeds
+}
+
+func TestFeedsCapPerKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		feeds    Feeds[keyedPost]
+		perKey   int
+		top      int
+		expected []string
+	}{
+		{
+			name:     "feeds over the cap move after the top",
+			feeds:    keyedFeeds("a1:a", "a2:a", "a3:a", "b1:b", "a4:a", "c1:c", "b2:b"),
+			perKey:   2,
+			top:      4,
+			expected: []string{"a1", "a2", "b1", "c1", "a3", "a4", "b2"},
+		},
+		{
+			name:     "feeds without a key are not capped",
+			feeds:    keyedFeeds("x1:", "x2:", "x3:", "a1:a"),
+			perKey:   1,
+			top:      3,
+			expected: []string{"x1", "x2", "x3", "a1"},
+		},
+		{
+			name:     "too few other feeds to fill the top",
+			feeds:    keyedFeeds("a1:a", "a2:a", "b1:b", "a3:a"),
+			perKey:   1,
+			top:      4,
+			expected: []string{"a1", "b1", "a2", "a3"},
+		},
+		{
+			name:     "no cap",
+			feeds:    keyedFeeds("a1:a", "a2:a", "b1:b"),
+			perKey:   0,
+			top:      3,
+			expected: []string{"a1", "a2", "b1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.feeds.CapPerKey(tt.perKey, tt.top)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %d feeds, got %d", len(tt.expected), len(got))
+			}
+			for i, id := range tt.expected {
+				if got[i].ID != id {
+					t.Fatalf("expected %v at index %d, got %v", id, i, got[i].ID)
+				}
+			}
+		})
+	}
+
+	t.Run("data that is not keyed is left alone", func(t *testing.T) {
+		feeds := typedFeeds("p1:post", "p2:post", "p3:post")
+		got := feeds.CapPerKey(1, 3)
+		for i := range feeds {
+			if got[i].ID != feeds[i].ID {
+				t.Fatalf("expected the order to be kept, got %v at index %d", got[i].ID, i)
+			}
+		}
+	})
+}
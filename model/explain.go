@@ -0,0 +1,107 @@
+package model
+
+import (
+	"context"
+	"strings"
+)
+
+// PolicyResult is the outcome of evaluating a single policy.
+type PolicyResult struct {
+	Policy   string `json:"policy"`
+	Violated bool   `json:"violated"`
+	// Values holds what the policy was judged on: resolver answers (views,
+	// attributes, timestamps, ...), the evaluation time and the client.
+	Values map[string]any `json:"values,omitempty"`
+	// Error is set when the policy could not be evaluated, in which case it
+	// does not take effect and Violated is false.
+	Error string `json:"error,omitempty"`
+	// Atoms holds the result of every atom of an expr: policy.
+	Atoms []PolicyResult `json:"atoms,omitempty"`
+}
+
+// PolicyExplanation is a dry run of every policy on a feed for one user.
+type PolicyExplanation struct {
+	UserId string `json:"user_id"`
+	FeedId string `json:"feed_id"`
+	// Policy is the pin or relation row the policies were read from, nil when
+	// the feed carries no policies at all.
+	Policy  *Policy        `json:"policy,omitempty"`
+	Results []PolicyResult `json:"results"`
+	// Violated is the final verdict: true when the feed is hidden from the user.
+	Violated bool `json:"violated"`
+	// ViolatedPolicy is the first violated policy, the one
+	// BuildPolicyViolationMap would report.
+	ViolatedPolicy string `json:"violated_policy,omitempty"`
+}
+
+// Explain evaluates the policy like Violated does, but returns everything it
+// was judged on instead of logging. Every atom of an expr: policy is evaluated,
+// including ones the verdict does not depend on.
+func (p PolicyType) Explain(ctx context.Context, userId, feedId string, resolver PolicyResolver) PolicyResult {
+	result := PolicyResult{Policy: p.String(), Values: map[string]any{}}
+
+	if strings.HasPrefix(p.String(), Expr.String()+":") {
+		expr, err := ParsePolicyExpr(p.String())
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		atoms := map[PolicyType]PolicyResult{}
+		for _, atom := range expr.Atoms() {
+			if _, done := atoms[atom]; done {
+				continue
+			}
+			atoms[atom] = atom.Explain(ctx, userId, feedId, resolver)
+			result.Atoms = append(result.Atoms, atoms[atom])
+		}
+		violated, err := expr.violated(func(atom PolicyType) (bool, error) {
+			if atoms[atom].Error != "" {
+				return false, explainedError(atoms[atom].Error)
+			}
+			return atoms[atom].Violated, nil
+		})
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Violated = violated
+		return result
+	}
+
+	violated, err := p.check(ctx, userId, feedId, resolver, func(key string, value any) {
+		result.Values[key] = value
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Violated = violated
+	return result
+}
+
+// ExplainPolicies evaluates every policy without short-circuiting and reports
+// the verdict BuildPolicyViolationMap would reach.
+func ExplainPolicies(ctx context.Context, userId, feedId string, policies []string, resolver PolicyResolver) PolicyExplanation {
+	explanation := PolicyExplanation{
+		UserId:  userId,
+		FeedId:  feedId,
+		Results: []PolicyResult{},
+	}
+	for _, policy := range policies {
+		result := PolicyType(policy).Explain(ctx, userId, feedId, resolver)
+		explanation.Results = append(explanation.Results, result)
+		if result.Violated && !explanation.Violated {
+			explanation.Violated = true
+			explanation.ViolatedPolicy = policy
+		}
+	}
+	return explanation
+}
+
+// explainedError carries an atom's error message back into expression
+// evaluation.
+type explainedError string
+
+func (e explainedError) Error() string {
+	return string(e)
+}
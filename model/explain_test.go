@@ -0,0 +1,142 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicyTypeExplain(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.WithValue(context.Background(), NOW_KEY, now)
+
+	resolver := &mockPolicyResolver{
+		viewCounts: map[string]int64{"post1": 1500},
+		userAttrs:  map[string][]string{"user1": {"Cardiology"}},
+	}
+
+	t.Run("records resolver values", func(t *testing.T) {
+		result := PolicyType("exposure:1000").Explain(ctx, "user1", "post1", resolver)
+		if !result.Violated {
+			t.Error("expected violation")
+		}
+		if result.Values["views"] != int64(1500) {
+			t.Errorf("expected views 1500, got %v", result.Values["views"])
+		}
+		if result.Error != "" {
+			t.Errorf("unexpected error %s", result.Error)
+		}
+	})
+
+	t.Run("records attributes", func(t *testing.T) {
+		result := PolicyType("istarget:cardiology").Explain(ctx, "user1", "post1", resolver)
+		if result.Violated {
+			t.Error("expected no violation")
+		}
+		attrs, _ := result.Values["attributes"].([]string)
+		if len(attrs) != 1 || attrs[0] != "Cardiology" {
+			t.Errorf("expected attributes [Cardiology], got %v", result.Values["attributes"])
+		}
+	})
+
+	t.Run("records evaluation time", func(t *testing.T) {
+		result := PolicyType("unexpose:1700000000").Explain(ctx, "user1", "post1", resolver)
+		if !result.Violated {
+			t.Error("expected violation")
+		}
+		if result.Values["now"] != now.Unix() {
+			t.Errorf("expected now %d, got %v", now.Unix(), result.Values["now"])
+		}
+	})
+
+	t.Run("reports parse errors", func(t *testing.T) {
+		result := PolicyType("exposure:abc").Explain(ctx, "user1", "post1", resolver)
+		if result.Violated || result.Error == "" {
+			t.Errorf("expected an error and no violation, got %+v", result)
+		}
+	})
+
+	t.Run("reports resolver errors", func(t *testing.T) {
+		result := PolicyType("exposure:1000").Explain(ctx, "user1", "post1", &mockPolicyResolver{err: errors.New("db error")})
+		if result.Violated || result.Error == "" {
+			t.Errorf("expected an error and no violation, got %+v", result)
+		}
+	})
+
+	t.Run("evaluates every atom of an expression", func(t *testing.T) {
+		// the first atom decides the or, but the second is still explained
+		result := PolicyType("expr:istarget:cardiology or exposure:1000").Explain(ctx, "user1", "post1", resolver)
+		if result.Violated {
+			t.Error("expected no violation")
+		}
+		if len(result.Atoms) != 2 {
+			t.Fatalf("expected 2 atoms, got %d", len(result.Atoms))
+		}
+		if result.Atoms[1].Policy != "exposure:1000" || !result.Atoms[1].Violated {
+			t.Errorf("expected exposure atom to be violated, got %+v", result.Atoms[1])
+		}
+	})
+
+	t.Run("expression verdict matches Violated", func(t *testing.T) {
+		for _, policy := range []PolicyType{
+			"expr:istarget:cardiology and exposure:1000",
+			"expr:not istarget:cardiology or exposure:2000",
+			"expr:(istarget:neurology or exposure:2000) and not unexpose:1700000000",
+		} {
+			if got, want := policy.Explain(ctx, "user1", "post1", resolver).Violated, policy.Violated(ctx, "user1", "post1", resolver); got != want {
+				t.Errorf("%s: Explain violated=%v, Violated=%v", policy, got, want)
+			}
+		}
+	})
+
+	t.Run("expression with an undecided atom", func(t *testing.T) {
+		result := PolicyType("expr:not istarget:cardiology").Explain(ctx, "user1", "post1", &mockPolicyResolver{userAttrsErr: errors.New("db error")})
+		if result.Violated || result.Error == "" {
+			t.Errorf("expected an error and no violation, got %+v", result)
+		}
+		if len(result.Atoms) != 1 || result.Atoms[0].Error == "" {
+			t.Errorf("expected the atom error to be reported, got %+v", result.Atoms)
+		}
+	})
+
+	t.Run("unparsable expression", func(t *testing.T) {
+		result := PolicyType("expr:(istarget:cardiology").Explain(ctx, "user1", "post1", resolver)
+		if result.Violated || result.Error == "" {
+			t.Errorf("expected an error and no violation, got %+v", result)
+		}
+	})
+}
+
+func TestExplainPolicies(t *testing.T) {
+	ctx := context.Background()
+	resolver := &mockPolicyResolver{viewCounts: map[string]int64{"post1": 1500}}
+
+	explanation := ExplainPolicies(ctx, "user1", "post1", []string{
+		"exposure:abc",
+		"exposure:2000",
+		"exposure:1000",
+		"unexpose:1000000000",
+	}, resolver)
+
+	if len(explanation.Results) != 4 {
+		t.Fatalf("expected every policy to be evaluated, got %d results", len(explanation.Results))
+	}
+	if !explanation.Violated {
+		t.Error("expected the feed to be hidden")
+	}
+	if explanation.ViolatedPolicy != "exposure:1000" {
+		t.Errorf("expected first violated policy exposure:1000, got %s", explanation.ViolatedPolicy)
+	}
+	if explanation.Results[0].Error == "" {
+		t.Error("expected the unparsable policy to report an error")
+	}
+	if !explanation.Results[3].Violated {
+		t.Error("expected later policies to be evaluated after the first violation")
+	}
+
+	empty := ExplainPolicies(ctx, "user1", "post1", nil, resolver)
+	if empty.Violated || empty.Results == nil {
+		t.Errorf("expected a visible feed with empty results, got %+v", empty)
+	}
+}
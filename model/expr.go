@@ -0,0 +1,232 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PolicyExpr is a boolean expression over policy atoms, stored as a single
+// element of Policy.Policies with the "expr:" prefix:
+//
+//	expr:(istarget:student or unexpose:1735689600) and not istarget:intern
+//
+// An atom is any plain policy and is true when it is satisfied, i.e. not
+// violated: "exposure:1000" reads as "at most 1000 views". "not" binds tighter
+// than "and", which binds tighter than "or"; parentheses group. The expression
+// is violated when it evaluates to false.
+//
+// An atom that cannot be evaluated (unparsable, resolver error, ...) is
+// unknown rather than satisfied, so "not" cannot turn a broken atom into a
+// violation. Unknowns only matter when they decide the result: "a or b" is
+// satisfied when either side is, whatever the other. When the result is
+// unknown the expression does not take effect, like any other policy.
+type PolicyExpr struct {
+	op       exprOp
+	atom     PolicyType
+	operands []*PolicyExpr
+}
+
+type exprOp int
+
+const (
+	exprAtom exprOp = iota
+	exprNot
+	exprAnd
+	exprOr
+)
+
+// expression keywords; lower-case only, as the SQL validator only accepts
+// lower-case policies
+const (
+	exprKeywordAnd = "and"
+	exprKeywordOr  = "or"
+	exprKeywordNot = "not"
+)
+
+// ParsePolicyExpr parses an "expr:" policy. The prefix is optional.
+func ParsePolicyExpr(policy string) (*PolicyExpr, error) {
+	tokens := tokenizePolicyExpr(strings.TrimPrefix(policy, Expr.String()+":"))
+	if len(tokens) == 0 {
+		return nil, errors.New("empty policy expression")
+	}
+	parser := &exprParser{tokens: tokens}
+	expr, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q in policy expression", tokens[parser.pos])
+	}
+	return expr, nil
+}
+
+// Atoms returns every plain policy referenced by the expression, in order.
+func (e *PolicyExpr) Atoms() []PolicyType {
+	if e.op == exprAtom {
+		return []PolicyType{e.atom}
+	}
+	var atoms []PolicyType
+	for _, operand := range e.operands {
+		atoms = append(atoms, operand.Atoms()...)
+	}
+	return atoms
+}
+
+func (e *PolicyExpr) String() string {
+	switch e.op {
+	case exprAtom:
+		return e.atom.String()
+	case exprNot:
+		return exprKeywordNot + " " + e.operands[0].group()
+	default:
+		keyword := exprKeywordAnd
+		if e.op == exprOr {
+			keyword = exprKeywordOr
+		}
+		parts := make([]string, len(e.operands))
+		for i, operand := range e.operands {
+			parts[i] = operand.group()
+		}
+		return strings.Join(parts, " "+keyword+" ")
+	}
+}
+
+func (e *PolicyExpr) group() string {
+	if e.op == exprAnd || e.op == exprOr {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+func (e *PolicyExpr) check(ctx context.Context, userId, feedId string, resolver PolicyResolver) (bool, error) {
+	return e.violated(func(atom PolicyType) (bool, error) {
+		return atom.check(ctx, userId, feedId, resolver, nil)
+	})
+}
+
+// violated reports whether the expression is violated given how each atom
+// evaluates. Atoms are evaluated lazily, left to right.
+func (e *PolicyExpr) violated(atomViolated func(PolicyType) (bool, error)) (bool, error) {
+	satisfied, err := e.satisfied(atomViolated)
+	if err != nil {
+		return false, err
+	}
+	return !satisfied, nil
+}
+
+// satisfied evaluates the expression in three-valued logic, where a non-nil
+// error is "unknown".
+func (e *PolicyExpr) satisfied(atomViolated func(PolicyType) (bool, error)) (bool, error) {
+	switch e.op {
+	case exprAtom:
+		violated, err := atomViolated(e.atom)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", e.atom, err)
+		}
+		return !violated, nil
+	case exprNot:
+		satisfied, err := e.operands[0].satisfied(atomViolated)
+		return !satisfied, err
+	default:
+		// and: any false decides, or: any true decides
+		decisive := e.op == exprOr
+		var unknown error
+		for _, operand := range e.operands {
+			satisfied, err := operand.satisfied(atomViolated)
+			if err != nil {
+				if unknown == nil {
+					unknown = err
+				}
+				continue
+			}
+			if satisfied == decisive {
+				return decisive, nil
+			}
+		}
+		return !decisive, unknown
+	}
+}
+
+func tokenizePolicyExpr(s string) []string {
+	s = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(s)
+	return strings.Fields(s)
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) parseOr() (*PolicyExpr, error) {
+	return p.parseBinary(exprOr, exprKeywordOr, p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (*PolicyExpr, error) {
+	return p.parseBinary(exprAnd, exprKeywordAnd, p.parseUnary)
+}
+
+func (p *exprParser) parseBinary(op exprOp, keyword string, next func() (*PolicyExpr, error)) (*PolicyExpr, error) {
+	first, err := next()
+	if err != nil {
+		return nil, err
+	}
+	operands := []*PolicyExpr{first}
+	for p.peek() == keyword {
+		p.pos++
+		operand, err := next()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &PolicyExpr{op: op, operands: operands}, nil
+}
+
+func (p *exprParser) parseUnary() (*PolicyExpr, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, errors.New("unexpected end of policy expression")
+	case exprKeywordNot:
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &PolicyExpr{op: exprNot, operands: []*PolicyExpr{operand}}, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("missing closing parenthesis in policy expression")
+		}
+		p.pos++
+		return expr, nil
+	case ")", exprKeywordAnd, exprKeywordOr:
+		return nil, fmt.Errorf("unexpected %q in policy expression", token)
+	}
+	p.pos++
+	name, param, ok := strings.Cut(token, ":")
+	if !ok || name == "" || param == "" {
+		return nil, fmt.Errorf("invalid policy %q in policy expression", token)
+	}
+	if name == Expr.String() {
+		return nil, errors.New("policy expressions cannot be nested with expr:, use parentheses")
+	}
+	return &PolicyExpr{op: exprAtom, atom: PolicyType(token)}, nil
+}
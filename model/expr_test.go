@@ -0,0 +1,188 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParsePolicyExpr(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expected      string
+		expectedAtoms int
+		expectedError bool
+	}{
+		{
+			name:          "single atom",
+			input:         "expr:istarget:student",
+			expected:      "istarget:student",
+			expectedAtoms: 1,
+		},
+		{
+			name:          "prefix is optional",
+			input:         "istarget:student or istarget:resident",
+			expected:      "istarget:student or istarget:resident",
+			expectedAtoms: 2,
+		},
+		{
+			name:          "and binds tighter than or",
+			input:         "expr:istarget:a or istarget:b and istarget:c",
+			expected:      "istarget:a or (istarget:b and istarget:c)",
+			expectedAtoms: 3,
+		},
+		{
+			name:          "parentheses group",
+			input:         "expr:(istarget:student or unexpose:1735689600) and not exposure:1000",
+			expected:      "(istarget:student or unexpose:1735689600) and not exposure:1000",
+			expectedAtoms: 3,
+		},
+		{
+			name:          "parentheses without spaces",
+			input:         "expr:not(istarget:a or istarget:b)",
+			expected:      "not (istarget:a or istarget:b)",
+			expectedAtoms: 2,
+		},
+		{
+			name:          "double negation",
+			input:         "expr:not not istarget:a",
+			expected:      "not not istarget:a",
+			expectedAtoms: 1,
+		},
+		{name: "empty", input: "expr:", expectedError: true},
+		{name: "dangling operator", input: "expr:istarget:a and", expectedError: true},
+		{name: "leading operator", input: "expr:or istarget:a", expectedError: true},
+		{name: "missing closing parenthesis", input: "expr:(istarget:a or istarget:b", expectedError: true},
+		{name: "unbalanced closing parenthesis", input: "expr:istarget:a)", expectedError: true},
+		{name: "adjacent atoms", input: "expr:istarget:a istarget:b", expectedError: true},
+		{name: "atom without param", input: "expr:istarget", expectedError: true},
+		{name: "nested expr", input: "expr:expr:istarget:a", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParsePolicyExpr(tt.input)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("expected error but got expression %s", expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expr.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, expr.String())
+			}
+			if len(expr.Atoms()) != tt.expectedAtoms {
+				t.Errorf("expected %d atoms, got %d", tt.expectedAtoms, len(expr.Atoms()))
+			}
+		})
+	}
+}
+
+func TestPolicyTypeViolatedExpr(t *testing.T) {
+	launch := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	beforeLaunch := context.WithValue(context.Background(), NOW_KEY, launch.Add(-time.Hour))
+	afterLaunch := context.WithValue(context.Background(), NOW_KEY, launch.Add(time.Hour))
+
+	// show if (student OR before launch date) AND not over 1000 views; an atom
+	// reads as "satisfied", so the cap needs no "not"
+	const policy = PolicyType("expr:(istarget:student or unexpose:1735689600) and exposure:1000")
+
+	student := map[string][]string{"user1": {"student"}}
+	resident := map[string][]string{"user1": {"resident"}}
+
+	tests := []struct {
+		name             string
+		ctx              context.Context
+		policy           PolicyType
+		resolver         PolicyResolver
+		expectedViolated bool
+	}{
+		{
+			name:             "student after launch, under cap",
+			ctx:              afterLaunch,
+			policy:           policy,
+			resolver:         &mockPolicyResolver{userAttrs: student},
+			expectedViolated: false,
+		},
+		{
+			name:             "non-student before launch, under cap",
+			ctx:              beforeLaunch,
+			policy:           policy,
+			resolver:         &mockPolicyResolver{userAttrs: resident},
+			expectedViolated: false,
+		},
+		{
+			name:             "non-student after launch (violation)",
+			ctx:              afterLaunch,
+			policy:           policy,
+			resolver:         &mockPolicyResolver{userAttrs: resident},
+			expectedViolated: true,
+		},
+		{
+			name:   "student over cap (violation)",
+			ctx:    afterLaunch,
+			policy: policy,
+			resolver: &mockPolicyResolver{
+				userAttrs:  student,
+				viewCounts: map[string]int64{"post1": 1500},
+			},
+			expectedViolated: true,
+		},
+		{
+			name:             "not inverts a satisfied atom (violation)",
+			ctx:              afterLaunch,
+			policy:           "expr:not istarget:student",
+			resolver:         &mockPolicyResolver{userAttrs: student},
+			expectedViolated: true,
+		},
+		{
+			name:             "not over a broken atom does not take effect",
+			ctx:              afterLaunch,
+			policy:           "expr:not istarget:student",
+			resolver:         &mockPolicyResolver{userAttrsErr: errors.New("db error")},
+			expectedViolated: false,
+		},
+		{
+			name:             "or is decided by a satisfied side despite a broken one",
+			ctx:              beforeLaunch,
+			policy:           "expr:istarget:student or unexpose:1735689600",
+			resolver:         &mockPolicyResolver{userAttrsErr: errors.New("db error")},
+			expectedViolated: false,
+		},
+		{
+			name:             "and is decided by a violated side despite a broken one (violation)",
+			ctx:              afterLaunch,
+			policy:           "expr:istarget:student and unexpose:1735689600",
+			resolver:         &mockPolicyResolver{userAttrsErr: errors.New("db error")},
+			expectedViolated: true,
+		},
+		{
+			name:             "undecided and does not take effect",
+			ctx:              beforeLaunch,
+			policy:           "expr:istarget:student and unexpose:1735689600",
+			resolver:         &mockPolicyResolver{userAttrsErr: errors.New("db error")},
+			expectedViolated: false,
+		},
+		{
+			name:             "unparsable expression does not take effect",
+			ctx:              afterLaunch,
+			policy:           "expr:(istarget:student",
+			resolver:         &mockPolicyResolver{},
+			expectedViolated: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.policy.Violated(tt.ctx, "user1", "post1", tt.resolver)
+			if result != tt.expectedViolated {
+				t.Errorf("expected violated=%v, got %v", tt.expectedViolated, result)
+			}
+		})
+	}
+}
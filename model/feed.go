@@ -2,10 +2,7 @@ package model
 
 import (
 	"context"
-	"errors"
-	"slices"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -25,6 +22,39 @@ const POSITION_KEY contextKey = "position"
 // fade-out in one place. Falls back to GetColdstart when absent.
 const COLD_START_IDS_KEY contextKey = "coldstart_ids"
 
+// COLD_START_AUDIENCE_KEY optionally names the audience the COLD_START_IDS_KEY
+// set was assembled for, for Trace only.
+const COLD_START_AUDIENCE_KEY contextKey = "coldstart_audience"
+
+// NOW_KEY optionally carries the time.Time that time-based policies (inexpose,
+// unexpose) are evaluated against. Set it to preview what a feed looks like at
+// another moment ("tomorrow at 9am"), or to pin the clock in tests. Falls back
+// to time.Now() when absent.
+const NOW_KEY contextKey = "now"
+
+// USER_ID_KEY optionally carries the id of the user the feed is assembled for.
+// GetFeeds evaluates relation member policies against it when serving a posts
+// slot; without it, user-specific policies (istarget, ...) see an empty user.
+const USER_ID_KEY contextKey = "user_id"
+
+// PAGE_SIZE_KEY optionally carries the size of the first page as an int.
+// GetFeeds counts AnchorEnd pins back from it; without it, the whole list is
+// one page.
+const PAGE_SIZE_KEY contextKey = "page_size"
+
+// TRACE_KEY optionally carries a *Trace that GetFeeds fills in with how it
+// assembled the feed.
+const TRACE_KEY contextKey = "trace"
+
+// Now returns the evaluation time carried in ctx under NOW_KEY, or the current
+// time when none is set.
+func Now(ctx context.Context) time.Time {
+	if now, ok := ctx.Value(NOW_KEY).(time.Time); ok && !now.IsZero() {
+		return now
+	}
+	return time.Now()
+}
+
 // Coldstart audiences map a user condition to the coldstart table that serves it.
 // Each audience is backed by its own feed_coldstart* table (see store.GetColdstartByAudience).
 const (
@@ -77,6 +107,16 @@ const (
 	Distinct PolicyType = "distinct"
 	Duration PolicyType = "duration"
 	IsTheOne PolicyType = "istheone"
+
+	After      PolicyType = "after"
+	Delay      PolicyType = "delay"
+	Cooldown   PolicyType = "cooldown"
+	MinCTR     PolicyType = "minctr"
+	Dismissed  PolicyType = "dismissed"
+	Expr       PolicyType = "expr"
+	Platform   PolicyType = "platform"
+	MinVersion PolicyType = "minversion"
+	MaxVersion PolicyType = "maxversion"
 )
 
 type PolicyResolver interface {
@@ -85,149 +125,79 @@ type PolicyResolver interface {
 	GetUserAttribute(ctx context.Context, userID string) ([]string, error)
 }
 
-func (p PolicyType) String() string {
-	return string(p)
+// FirstViewResolver is implemented by resolvers that can tell when a user first
+// viewed a feed. It is optional: the after policy does not take effect when the
+// resolver passed in does not implement it.
+type FirstViewResolver interface {
+	// GetViewerPostFirstViewedAt returns the Unix time userID first viewed
+	// postID, or 0 if they never have.
+	GetViewerPostFirstViewedAt(ctx context.Context, postID, userID string) (int64, error)
 }
 
-func (p PolicyType) exposureParamParser(ctx context.Context, parsed []string) (bool, int64, error) {
-	var err error
-	var duration int64
-	var unique bool
-loop:
-	for i := 0; i < len(parsed); i++ {
-		switch parsed[i] {
-		case Distinct.String():
-			unique = true
-		case Duration.String():
-			if i == len(parsed)-1 {
-				err = errors.New("helper policy parsing error for polcy type duration")
-				break loop // there should be a number following duration which defines how long the intercal is
-			}
-			duration, err = strconv.ParseInt(parsed[i+1], 10, 64)
-			if err != nil {
-				logging.Errorw(ctx, "failed parsing policy number", "policy", p, "param", parsed[i])
-				break loop
-			}
-			i++ // we have used up two params from the parsed strings
-		default:
-			err = errors.New("unknown helper policy for policy type exposure")
-			break loop
-		}
-	}
-	return unique, duration, err
+// LastViewResolver is implemented by resolvers that can tell when a user last
+// viewed a feed. It is optional: the cooldown policy does not take effect when
+// the resolver passed in does not implement it.
+type LastViewResolver interface {
+	// GetViewerPostLastViewedAt returns the Unix time userID last viewed
+	// postID, or 0 if they never have.
+	GetViewerPostLastViewedAt(ctx context.Context, postID, userID string) (int64, error)
+}
+
+// ClickResolver is implemented by resolvers that count clicks on a feed. It is
+// optional: the minctr policy does not take effect without it.
+type ClickResolver interface {
+	GetPostClickCount(ctx context.Context, postID string) (int64, error)
+}
+
+// DismissResolver is implemented by resolvers that count how often a user
+// dismissed a feed. It is optional: the dismissed policy does not take effect
+// without it.
+type DismissResolver interface {
+	GetViewerPostDismissCount(ctx context.Context, postID, userID string) (int64, error)
+}
+
+func (p PolicyType) String() string {
+	return string(p)
 }
 
 func (p PolicyType) Violated(ctx context.Context, userId, feedId string, resolver PolicyResolver) bool {
 	// whenever there is a violation to policy attribute, the post is removed from the feed
-	parsed := strings.Split(p.String(), ":")
-	if len(parsed) <= 1 {
-		logging.Errorw(ctx, "failed parsing policy, the policy will not take effect", "feed_id", feedId, "policy", p)
+	violated, err := p.check(ctx, userId, feedId, resolver, nil)
+	if err != nil {
+		logging.Errorw(ctx, "the policy will not take effect", "feed_id", feedId, "policy", p, "err", err)
 		return false
 	}
-	policyName, rawParam := parsed[0], parsed[1]
-	logging.Debug(ctx, "examine violation of policy", "feed_id", feedId, "policy", p, "param", rawParam)
-	switch policyName {
-	case Exposure.String():
-		limit, err := strconv.ParseInt(rawParam, 10, 64)
-		if err != nil {
-			logging.Errorw(ctx, "failed parsing policy number, the policy will not take effect", "feed_id", feedId, "policy", p, "param", rawParam)
-			return false
-		}
-		if resolver == nil {
-			logging.Errorw(ctx, "resolver cannot be nil, the policy will not take effect", "feed_id", feedId, "policy", p)
-			return false
-		}
-		var duration int64
-		var uniqueUser bool
-		if len(parsed) > 2 {
-			uniqueUser, duration, err = Exposure.exposureParamParser(ctx, parsed[2:])
-			if err != nil {
-				logging.Errorw(ctx, "failed to parse exposure suffix", "feed_id", feedId, "policy", p, "err", err)
-				return false
-			}
-		}
-		views, err := resolver.GetPostViewCount(ctx, feedId, uniqueUser, duration)
-		if err != nil {
-			logging.Errorw(ctx, "failed getting post's view count, the policy will not take effect", "feed_id", feedId, "policy", p)
-			return false
-		}
-		if views > limit {
-			return true
-		}
-	case IsTheOne.String():
-		limit, err := strconv.ParseInt(rawParam, 10, 64)
-		if err != nil {
-			logging.Errorw(ctx, "failed parsing policy number, the policy will not take effect", "feed_id", feedId, "policy", p, "param", rawParam)
-			return false
-		}
-		if len(parsed) < 3 {
-			logging.Errorw(ctx, "failed to parse istheone suffix", "feed_id", feedId, "policy", p, "err", err)
-			return false
-		}
-		views, err := resolver.GetViewerPostViewCount(ctx, feedId, parsed[2])
-		if err != nil {
-			logging.Errorw(ctx, "failed getting user's view count on post, the policy will not take effect", "feed_id", feedId, "policy", p)
-			return false
-		}
-		if views > limit {
-			return true
-		}
-	case Inexpose.String(): // the time when the feed should start having exposure
-		inexposeTime, err := strconv.ParseInt(rawParam, 10, 64)
-		if err != nil {
-			logging.Errorw(ctx, "failed parsing policy number, the policy will not take effect", "feed_id", feedId, "policy", p, "param", rawParam)
-			return false
-		}
-		if time.Now().Unix() < inexposeTime {
-			return true
-		}
-	case Unexpose.String(): // the time when the feed should stop having exposure
-		unexposeTime, err := strconv.ParseInt(rawParam, 10, 64)
+	return violated
+}
+
+// recorder collects the inputs a policy was judged on, for Explain. A nil
+// recorder discards them.
+type recorder func(key string, value any)
+
+func (r recorder) set(key string, value any) {
+	if r != nil {
+		r(key, value)
+	}
+}
+
+// check reports whether the policy is violated. A non-nil error means the
+// policy could not be evaluated and must not take effect.
+func (p PolicyType) check(ctx context.Context, userId, feedId string, resolver PolicyResolver, record recorder) (bool, error) {
+	if strings.HasPrefix(p.String(), Expr.String()+":") {
+		expr, err := ParsePolicyExpr(p.String())
 		if err != nil {
-			logging.Errorw(ctx, "failed parsing policy number, the policy will not take effect", "feed_id", feedId, "policy", p, "param", rawParam)
-			return false
-		}
-		if time.Now().Unix() > unexposeTime {
-			return true
+			return false, err
 		}
-	case Istarget.String(): // the target attribute which the feed should have a match
-		if userAttrs, err := resolver.GetUserAttribute(ctx, userId); err != nil {
-			logging.Errorw(ctx, "failed getting user attribute, the policy will not take effect", "feed_id", feedId, "policy", p)
-			return false
-		} else {
-			// Every segment after the policy name is one alternative, ORed together:
-			// "istarget:cardiology:neurology" matches a user holding either. Separate
-			// istarget policies stay ANDed, so pairing it with "istarget:male" reads as
-			// (cardiology OR neurology) AND male — the shape an audience filter needs.
-			// A single-segment policy is unchanged, which is every policy written to
-			// date, so this is purely additive.
-			//
-			// Matching is case-insensitive: the validate_policies_format trigger
-			// installed by store.addPolicyFormatConstraintSQL only accepts
-			// [a-z0-9:_-] for the param, so a policy can never carry an
-			// upper-case attribute. Resolvers,
-			// meanwhile, return attributes verbatim from their own vocabulary (e.g.
-			// apen-api returns specialties such as "Cardiology"). Comparing verbatim
-			// would make those attributes impossible to target at all.
-			matched := false
-			for _, target := range parsed[1:] {
-				if slices.ContainsFunc(userAttrs, func(attr string) bool {
-					return strings.EqualFold(attr, target)
-				}) {
-					matched = true
-					break
-				}
-			}
-			if !matched {
-				// no attribute matches any of the target attributes, the policy is violated
-				return true
-			}
-			// matched - no violation, return false to next policy
-		}
-	default:
-		logging.Errorw(ctx, "unknown policy, the policy will not take effect", "feed_id", feedId, "policy", p)
+		return expr.check(ctx, userId, feedId, resolver)
+	}
+
+	kind, in, err := p.parse()
+	if err != nil {
+		return false, err
 	}
-	return false
+	logging.Debug(ctx, "examine violation of policy", "feed_id", feedId, "policy", p, "param", in.Params)
+	in.UserId, in.FeedId, in.Resolver, in.record = userId, feedId, resolver, record
+	return kind.Evaluate(ctx, in)
 }
 
 type Policy struct {
@@ -235,4 +205,83 @@ type Policy struct {
 	FeedType FeedType       `json:"type" db:"feed_type"`
 	Position int            `json:"position" db:"position"`
 	Policies pq.StringArray `json:"policies" db:"policies"`
+
+	// MaxPosition turns the pin into a range pin: it lands on any free index
+	// from Position to MaxPosition. Nil for an exact position.
+	MaxPosition *int `json:"max_position,omitempty" db:"max_position"`
+	// MinSpacing is how many unpinned feeds must at least separate the pin
+	// from any other pin. Only range pins move to honour it.
+	MinSpacing int `json:"min_spacing,omitempty" db:"min_spacing"`
+	// Anchor is what Position and MaxPosition count from. Empty means
+	// AnchorStart.
+	Anchor Anchor `json:"anchor,omitempty" db:"anchor"`
+	// Coldstart makes the pin apply to coldstart feeds as well, where it
+	// takes its position before the coldstart feeds are inserted.
+	Coldstart bool `json:"coldstart,omitempty" db:"coldstart"`
+}
+
+// Anchor is the end of the first page a pin position counts from.
+type Anchor string
+
+const (
+	// AnchorStart counts positions from the top: 0 is the first feed.
+	AnchorStart Anchor = "start"
+	// AnchorEnd counts positions back from the end of the first page: 0 is
+	// the last feed of the page (see PAGE_SIZE_KEY).
+	AnchorEnd Anchor = "end"
+)
+
+// Valid reports whether a is a known anchor. Empty is valid and means
+// AnchorStart.
+func (a Anchor) Valid() bool {
+	return a == "" || a == AnchorStart || a == AnchorEnd
+}
+
+// PinGap is what happens to a pin whose position lies past the end of the
+// feed, when there are too few other feeds to reach it.
+type PinGap string
+
+const (
+	// PinGapAppend serves the pin at the end of the feed instead. It is the
+	// default.
+	PinGapAppend PinGap = "append"
+	// PinGapDrop does not serve the pin.
+	PinGapDrop PinGap = "drop"
+	// PinGapBackfill pulls feeds from the service's backfill source to reach
+	// the pin, and appends the pin when it runs short.
+	PinGapBackfill PinGap = "backfill"
+)
+
+// Relation is a feed_relation row: FeedId is queued behind the slot holder
+// RelatedFeedId and carries its own policies. Members are promoted by
+// descending Priority, then descending Weight.
+type Relation struct {
+	FeedId        string         `json:"id" db:"feed_id"`
+	RelatedFeedId string         `json:"related_id" db:"related_feed_id"`
+	Policies      pq.StringArray `json:"policies" db:"policies"`
+	Priority      int            `json:"priority" db:"priority"`
+	Weight        float64        `json:"weight" db:"weight"`
+}
+
+// Group is a pinned slot with the members queued behind its holder, in
+// promotion order. Only posts slots have members.
+type Group struct {
+	Holder  Policy     `json:"holder"`
+	Members []Relation `json:"members"`
+}
+
+// InvalidPolicy is a stored policy that fails ValidatePolicy. RelatedFeedId is
+// set when it was found on a feed_relation row.
+type InvalidPolicy struct {
+	FeedId        string `json:"feed_id"`
+	RelatedFeedId string `json:"related_feed_id,omitempty"`
+	Policy        string `json:"policy"`
+	Error         string `json:"error"`
+}
+
+// Keyed is implemented by feed data that can be grouped by a key other than
+// its id, such as its author. It is optional: feeds whose data does not
+// implement it, or returns an empty key, are not grouped.
+type Keyed interface {
+	GetKey() string
 }
@@ -637,3 +637,417 @@ func TestPolicyTypeViolated(t *testing.T) {
 		})
 	}
 }
+
+func TestNow(t *testing.T) {
+	fixed := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("uses the time carried in context", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), NOW_KEY, fixed)
+		if got := Now(ctx); !got.Equal(fixed) {
+			t.Errorf("expected %v, got %v", fixed, got)
+		}
+	})
+
+	t.Run("falls back to wall clock when absent", func(t *testing.T) {
+		before := time.Now()
+		got := Now(context.Background())
+		if got.Before(before) || got.After(time.Now()) {
+			t.Errorf("expected wall clock time, got %v", got)
+		}
+	})
+
+	t.Run("ignores zero time", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), NOW_KEY, time.Time{})
+		if Now(ctx).IsZero() {
+			t.Error("expected zero time to fall back to wall clock")
+		}
+	})
+}
+
+func TestPolicyTypeViolatedWithClock(t *testing.T) {
+	launch := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	launchUnix := strconv.FormatInt(launch.Unix(), 10)
+
+	tests := []struct {
+		name             string
+		policy           PolicyType
+		now              time.Time
+		expectedViolated bool
+	}{
+		{
+			name:             "inexpose - one second before start (violation)",
+			policy:           PolicyType("inexpose:" + launchUnix),
+			now:              launch.Add(-time.Second),
+			expectedViolated: true,
+		},
+		{
+			name:             "inexpose - exactly at start",
+			policy:           PolicyType("inexpose:" + launchUnix),
+			now:              launch,
+			expectedViolated: false,
+		},
+		{
+			name:             "unexpose - exactly at end",
+			policy:           PolicyType("unexpose:" + launchUnix),
+			now:              launch,
+			expectedViolated: false,
+		},
+		{
+			name:             "unexpose - one second after end (violation)",
+			policy:           PolicyType("unexpose:" + launchUnix),
+			now:              launch.Add(time.Second),
+			expectedViolated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), NOW_KEY, tt.now)
+			result := tt.policy.Violated(ctx, "user1", "post1", &mockPolicyResolver{})
+			if result != tt.expectedViolated {
+				t.Errorf("expected violated=%v, got %v", tt.expectedViolated, result)
+			}
+		})
+	}
+}
+
+// mockHistoryResolver adds view history on top of mockPolicyResolver, keyed by
+// "userID/postID".
+type mockHistoryResolver struct {
+	mockPolicyResolver
+	firstViewedAt map[string]int64
+	lastViewedAt  map[string]int64
+	historyErr    error
+}
+
+func (m *mockHistoryResolver) GetViewerPostLastViewedAt(ctx context.Context, postID, userID string) (int64, error) {
+	if m.historyErr != nil {
+		return 0, m.historyErr
+	}
+	return m.lastViewedAt[userID+"/"+postID], nil
+}
+
+func (m *mockHistoryResolver) GetViewerPostFirstViewedAt(ctx context.Context, postID, userID string) (int64, error) {
+	if m.historyErr != nil {
+		return 0, m.historyErr
+	}
+	return m.firstViewedAt[userID+"/"+postID], nil
+}
+
+func TestPolicyTypeViolatedAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	twoHoursAgo := now.Add(-2 * time.Hour).Unix()
+
+	tests := []struct {
+		name             string
+		policy           PolicyType
+		resolver         PolicyResolver
+		expectedViolated bool
+	}{
+		{
+			name:             "prerequisite never viewed (violation)",
+			policy:           "after:post-a",
+			resolver:         &mockHistoryResolver{},
+			expectedViolated: true,
+		},
+		{
+			name:   "prerequisite viewed",
+			policy: "after:post-a",
+			resolver: &mockHistoryResolver{
+				firstViewedAt: map[string]int64{"user1/post-a": twoHoursAgo},
+			},
+			expectedViolated: false,
+		},
+		{
+			name:   "prerequisite viewed, delay elapsed",
+			policy: "after:post-a:delay:3600",
+			resolver: &mockHistoryResolver{
+				firstViewedAt: map[string]int64{"user1/post-a": twoHoursAgo},
+			},
+			expectedViolated: false,
+		},
+		{
+			name:   "prerequisite viewed, delay not elapsed (violation)",
+			policy: "after:post-a:delay:10800",
+			resolver: &mockHistoryResolver{
+				firstViewedAt: map[string]int64{"user1/post-a": twoHoursAgo},
+			},
+			expectedViolated: true,
+		},
+		{
+			name:   "another user's view does not count (violation)",
+			policy: "after:post-a",
+			resolver: &mockHistoryResolver{
+				firstViewedAt: map[string]int64{"user2/post-a": twoHoursAgo},
+			},
+			expectedViolated: true,
+		},
+		{
+			name:             "resolver without view history",
+			policy:           "after:post-a",
+			resolver:         &mockPolicyResolver{},
+			expectedViolated: false,
+		},
+		{
+			name:             "nil resolver",
+			policy:           "after:post-a",
+			resolver:         nil,
+			expectedViolated: false,
+		},
+		{
+			name:             "resolver error",
+			policy:           "after:post-a",
+			resolver:         &mockHistoryResolver{historyErr: errors.New("db error")},
+			expectedViolated: false,
+		},
+		{
+			name:             "unknown helper policy",
+			policy:           "after:post-a:wait:3600",
+			resolver:         &mockHistoryResolver{},
+			expectedViolated: false,
+		},
+		{
+			name:             "delay without seconds",
+			policy:           "after:post-a:delay",
+			resolver:         &mockHistoryResolver{},
+			expectedViolated: false,
+		},
+		{
+			name:             "invalid delay",
+			policy:           "after:post-a:delay:soon",
+			resolver:         &mockHistoryResolver{},
+			expectedViolated: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), NOW_KEY, now)
+			result := tt.policy.Violated(ctx, "user1", "post-b", tt.resolver)
+			if result != tt.expectedViolated {
+				t.Errorf("expected violated=%v, got %v", tt.expectedViolated, result)
+			}
+		})
+	}
+}
+
+func TestPolicyTypeViolatedCooldown(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tenMinutesAgo := now.Add(-10 * time.Minute).Unix()
+
+	tests := []struct {
+		name             string
+		policy           PolicyType
+		resolver         PolicyResolver
+		expectedViolated bool
+	}{
+		{
+			name:             "never viewed",
+			policy:           "cooldown:3600",
+			resolver:         &mockHistoryResolver{},
+			expectedViolated: false,
+		},
+		{
+			name:   "viewed within the interval (violation)",
+			policy: "cooldown:3600",
+			resolver: &mockHistoryResolver{
+				lastViewedAt: map[string]int64{"user1/post1": tenMinutesAgo},
+			},
+			expectedViolated: true,
+		},
+		{
+			name:   "viewed before the interval",
+			policy: "cooldown:300",
+			resolver: &mockHistoryResolver{
+				lastViewedAt: map[string]int64{"user1/post1": tenMinutesAgo},
+			},
+			expectedViolated: false,
+		},
+		{
+			name:   "first view is irrelevant",
+			policy: "cooldown:3600",
+			resolver: &mockHistoryResolver{
+				firstViewedAt: map[string]int64{"user1/post1": tenMinutesAgo},
+			},
+			expectedViolated: false,
+		},
+		{
+			name:             "invalid interval",
+			policy:           "cooldown:abc",
+			resolver:         &mockHistoryResolver{},
+			expectedViolated: false,
+		},
+		{
+			name:             "resolver without view history",
+			policy:           "cooldown:3600",
+			resolver:         &mockPolicyResolver{},
+			expectedViolated: false,
+		},
+		{
+			name:             "resolver error",
+			policy:           "cooldown:3600",
+			resolver:         &mockHistoryResolver{historyErr: errors.New("db error")},
+			expectedViolated: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), NOW_KEY, now)
+			result := tt.policy.Violated(ctx, "user1", "post1", tt.resolver)
+			if result != tt.expectedViolated {
+				t.Errorf("expected violated=%v, got %v", tt.expectedViolated, result)
+			}
+		})
+	}
+}
+
+// mockEngagementResolver adds click and dismissal counts on top of
+// mockPolicyResolver. Dismissals are keyed by "userID/postID".
+type mockEngagementResolver struct {
+	mockPolicyResolver
+	clicks        map[string]int64
+	dismissals    map[string]int64
+	engagementErr error
+}
+
+func (m *mockEngagementResolver) GetPostClickCount(ctx context.Context, postID string) (int64, error) {
+	if m.engagementErr != nil {
+		return 0, m.engagementErr
+	}
+	return m.clicks[postID], nil
+}
+
+func (m *mockEngagementResolver) GetViewerPostDismissCount(ctx context.Context, postID, userID string) (int64, error) {
+	if m.engagementErr != nil {
+		return 0, m.engagementErr
+	}
+	return m.dismissals[userID+"/"+postID], nil
+}
+
+func TestPolicyTypeViolatedEngagement(t *testing.T) {
+	ctx := context.Background()
+
+	views := func(n int64) mockPolicyResolver {
+		return mockPolicyResolver{viewCounts: map[string]int64{"post1": n}}
+	}
+
+	tests := []struct {
+		name             string
+		policy           PolicyType
+		resolver         PolicyResolver
+		expectedViolated bool
+	}{
+		{
+			name:             "minctr - ratio met",
+			policy:           "minctr:0.02",
+			resolver:         &mockEngagementResolver{mockPolicyResolver: views(1000), clicks: map[string]int64{"post1": 30}},
+			expectedViolated: false,
+		},
+		{
+			name:             "minctr - ratio below threshold (violation)",
+			policy:           "minctr:0.02",
+			resolver:         &mockEngagementResolver{mockPolicyResolver: views(1000), clicks: map[string]int64{"post1": 10}},
+			expectedViolated: true,
+		},
+		{
+			name:             "minctr - below threshold but too few impressions",
+			policy:           "minctr:0.02:after:5000",
+			resolver:         &mockEngagementResolver{mockPolicyResolver: views(1000), clicks: map[string]int64{"post1": 10}},
+			expectedViolated: false,
+		},
+		{
+			name:             "minctr - below threshold after enough impressions (violation)",
+			policy:           "minctr:0.02:after:500",
+			resolver:         &mockEngagementResolver{mockPolicyResolver: views(1000), clicks: map[string]int64{"post1": 10}},
+			expectedViolated: true,
+		},
+		{
+			name:             "minctr - no impressions yet",
+			policy:           "minctr:0.02",
+			resolver:         &mockEngagementResolver{},
+			expectedViolated: false,
+		},
+		{
+			name:             "minctr - invalid ratio",
+			policy:           "minctr:low",
+			resolver:         &mockEngagementResolver{mockPolicyResolver: views(1000)},
+			expectedViolated: false,
+		},
+		{
+			name:             "minctr - unknown helper",
+			policy:           "minctr:0.02:min:500",
+			resolver:         &mockEngagementResolver{mockPolicyResolver: views(1000)},
+			expectedViolated: false,
+		},
+		{
+			name:             "minctr - invalid impressions",
+			policy:           "minctr:0.02:after:many",
+			resolver:         &mockEngagementResolver{mockPolicyResolver: views(1000)},
+			expectedViolated: false,
+		},
+		{
+			name:             "minctr - resolver without clicks",
+			policy:           "minctr:0.02",
+			resolver:         &mockPolicyResolver{viewCounts: map[string]int64{"post1": 1000}},
+			expectedViolated: false,
+		},
+		{
+			name:             "minctr - view count error",
+			policy:           "minctr:0.02",
+			resolver:         &mockEngagementResolver{mockPolicyResolver: mockPolicyResolver{err: errors.New("db error")}},
+			expectedViolated: false,
+		},
+		{
+			name:             "minctr - click count error",
+			policy:           "minctr:0.02",
+			resolver:         &mockEngagementResolver{mockPolicyResolver: views(1000), engagementErr: errors.New("db error")},
+			expectedViolated: false,
+		},
+		{
+			name:             "dismissed - below count",
+			policy:           "dismissed:2",
+			resolver:         &mockEngagementResolver{dismissals: map[string]int64{"user1/post1": 1}},
+			expectedViolated: false,
+		},
+		{
+			name:             "dismissed - reached count (violation)",
+			policy:           "dismissed:2",
+			resolver:         &mockEngagementResolver{dismissals: map[string]int64{"user1/post1": 2}},
+			expectedViolated: true,
+		},
+		{
+			name:             "dismissed - other user's dismissals do not count",
+			policy:           "dismissed:1",
+			resolver:         &mockEngagementResolver{dismissals: map[string]int64{"user2/post1": 5}},
+			expectedViolated: false,
+		},
+		{
+			name:             "dismissed - invalid count",
+			policy:           "dismissed:many",
+			resolver:         &mockEngagementResolver{},
+			expectedViolated: false,
+		},
+		{
+			name:             "dismissed - resolver without dismissals",
+			policy:           "dismissed:1",
+			resolver:         &mockPolicyResolver{},
+			expectedViolated: false,
+		},
+		{
+			name:             "dismissed - resolver error",
+			policy:           "dismissed:1",
+			resolver:         &mockEngagementResolver{engagementErr: errors.New("db error")},
+			expectedViolated: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.policy.Violated(ctx, "user1", "post1", tt.resolver)
+			if result != tt.expectedViolated {
+				t.Errorf("expected violated=%v, got %v", tt.expectedViolated, result)
+			}
+		})
+	}
+}
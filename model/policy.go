@@ -0,0 +1,470 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PolicyKind describes one policy type: the name before the first colon, how
+// its params are parsed and how it is judged. Every built-in policy is a
+// PolicyKind; host applications add their own with RegisterPolicyKind.
+type PolicyKind struct {
+	// Name is the policy prefix, e.g. "exposure". Lower-case letters, digits
+	// and underscores, starting with a letter.
+	Name string
+	// Parse validates the params (every colon-separated segment after the
+	// name, at least one) and returns what Evaluate needs as PolicyInput.Parsed.
+	// It runs before every evaluation and on ValidatePolicy. Optional.
+	Parse func(params []string) (any, error)
+	// Evaluate reports whether the policy is violated, i.e. whether the feed
+	// must be hidden. An error means the policy cannot take effect.
+	Evaluate func(ctx context.Context, in PolicyInput) (bool, error)
+}
+
+// PolicyInput is what a PolicyKind is evaluated on.
+type PolicyInput struct {
+	UserId string
+	FeedId string
+	// Params are the raw colon-separated segments after the policy name.
+	Params []string
+	// Parsed is whatever the kind's Parse returned.
+	Parsed any
+	// Resolver is the resolver passed to Violated/BuildPolicyViolationMap.
+	// Custom kinds type-assert it to their own interface.
+	Resolver PolicyResolver
+
+	record recorder
+}
+
+// Record notes a value the verdict was based on, reported by Explain.
+func (in PolicyInput) Record(key string, value any) {
+	in.record.set(key, value)
+}
+
+var policyKindNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+var policyKinds = struct {
+	sync.RWMutex
+	kinds map[string]PolicyKind
+}{kinds: map[string]PolicyKind{}}
+
+// RegisterPolicyKind makes a policy kind available to every evaluation and to
+// the policy format trigger store.NewFeed installs, so custom kinds must be
+// registered before the store is created. Names are unique; built-in names
+// and "expr" are taken.
+func RegisterPolicyKind(kind PolicyKind) error {
+	if !policyKindNamePattern.MatchString(kind.Name) {
+		return fmt.Errorf("invalid policy kind name %q", kind.Name)
+	}
+	if kind.Name == Expr.String() {
+		return fmt.Errorf("policy kind name %q is reserved", kind.Name)
+	}
+	if kind.Evaluate == nil {
+		return fmt.Errorf("policy kind %q has no evaluator", kind.Name)
+	}
+
+	policyKinds.Lock()
+	defer policyKinds.Unlock()
+	if _, exists := policyKinds.kinds[kind.Name]; exists {
+		return fmt.Errorf("policy kind %q is already registered", kind.Name)
+	}
+	policyKinds.kinds[kind.Name] = kind
+	return nil
+}
+
+// LookupPolicyKind returns the registered kind with the given name.
+func LookupPolicyKind(name string) (PolicyKind, bool) {
+	policyKinds.RLock()
+	defer policyKinds.RUnlock()
+	kind, ok := policyKinds.kinds[name]
+	return kind, ok
+}
+
+// PolicyKindNames returns the names of every registered kind, sorted.
+func PolicyKindNames() []string {
+	policyKinds.RLock()
+	defer policyKinds.RUnlock()
+	names := make([]string, 0, len(policyKinds.kinds))
+	for name := range policyKinds.kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidatePolicy checks that a policy names a registered kind and that the
+// kind accepts its params; for an expr: policy, that the expression parses and
+// every atom is valid. It does not touch any resolver.
+func ValidatePolicy(policy string) error {
+	if strings.HasPrefix(policy, Expr.String()+":") {
+		expr, err := ParsePolicyExpr(policy)
+		if err != nil {
+			return err
+		}
+		for _, atom := range expr.Atoms() {
+			if err := ValidatePolicy(atom.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	_, _, err := PolicyType(policy).parse()
+	return err
+}
+
+// parse splits the policy into its kind and params and runs the kind's Parse.
+func (p PolicyType) parse() (PolicyKind, PolicyInput, error) {
+	parsed := strings.Split(p.String(), ":")
+	if len(parsed) <= 1 {
+		return PolicyKind{}, PolicyInput{}, errors.New("failed parsing policy")
+	}
+	kind, ok := LookupPolicyKind(parsed[0])
+	if !ok {
+		return PolicyKind{}, PolicyInput{}, fmt.Errorf("unknown policy %q", parsed[0])
+	}
+	in := PolicyInput{Params: parsed[1:]}
+	if kind.Parse != nil {
+		var err error
+		if in.Parsed, err = kind.Parse(in.Params); err != nil {
+			return PolicyKind{}, PolicyInput{}, err
+		}
+	}
+	return kind, in, nil
+}
+
+func init() {
+	for _, kind := range []PolicyKind{
+		{Name: Exposure.String(), Parse: parseExposure, Evaluate: evaluateExposure},
+		{Name: IsTheOne.String(), Parse: parseIsTheOne, Evaluate: evaluateIsTheOne},
+		{Name: Inexpose.String(), Parse: parseTimestamp, Evaluate: evaluateInexpose},
+		{Name: Unexpose.String(), Parse: parseTimestamp, Evaluate: evaluateUnexpose},
+		{Name: Istarget.String(), Evaluate: evaluateIstarget},
+		{Name: After.String(), Parse: parseAfter, Evaluate: evaluateAfter},
+		{Name: Cooldown.String(), Parse: parseCount, Evaluate: evaluateCooldown},
+		{Name: MinCTR.String(), Parse: parseMinCTR, Evaluate: evaluateMinCTR},
+		{Name: Dismissed.String(), Parse: parseCount, Evaluate: evaluateDismissed},
+		{Name: Platform.String(), Evaluate: evaluatePlatform},
+		{Name: MinVersion.String(), Parse: parseVersionParam, Evaluate: evaluateMinVersion},
+		{Name: MaxVersion.String(), Parse: parseVersionParam, Evaluate: evaluateMaxVersion},
+	} {
+		if err := RegisterPolicyKind(kind); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func parseNumber(param string) (int64, error) {
+	n, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed parsing policy number %q: %w", param, err)
+	}
+	return n, nil
+}
+
+// parseCount accepts a single number: cooldown:{seconds}, dismissed:{count}.
+func parseCount(params []string) (any, error) {
+	return parseNumber(params[0])
+}
+
+// parseTimestamp accepts a single Unix time: inexpose/unexpose:{timestamp}.
+func parseTimestamp(params []string) (any, error) {
+	return parseNumber(params[0])
+}
+
+type exposureParams struct {
+	limit    int64
+	unique   bool
+	duration int64
+}
+
+func parseExposure(params []string) (any, error) {
+	limit, err := parseNumber(params[0])
+	if err != nil {
+		return nil, err
+	}
+	p := exposureParams{limit: limit}
+	suffix := params[1:]
+	for i := 0; i < len(suffix); i++ {
+		switch suffix[i] {
+		case Distinct.String():
+			p.unique = true
+		case Duration.String():
+			if i == len(suffix)-1 {
+				// there should be a number following duration which defines how long the interval is
+				return nil, errors.New("helper policy parsing error for policy type duration")
+			}
+			if p.duration, err = parseNumber(suffix[i+1]); err != nil {
+				return nil, err
+			}
+			i++ // we have used up two params from the parsed strings
+		default:
+			return nil, errors.New("unknown helper policy for policy type exposure")
+		}
+	}
+	return p, nil
+}
+
+func evaluateExposure(ctx context.Context, in PolicyInput) (bool, error) {
+	p := in.Parsed.(exposureParams)
+	if in.Resolver == nil {
+		return false, errors.New("resolver cannot be nil")
+	}
+	views, err := in.Resolver.GetPostViewCount(ctx, in.FeedId, p.unique, p.duration)
+	if err != nil {
+		return false, fmt.Errorf("failed getting post's view count: %w", err)
+	}
+	in.Record("views", views)
+	return views > p.limit, nil
+}
+
+type isTheOneParams struct {
+	limit  int64
+	userId string
+}
+
+func parseIsTheOne(params []string) (any, error) {
+	limit, err := parseNumber(params[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(params) < 2 {
+		return nil, errors.New("failed to parse istheone suffix")
+	}
+	return isTheOneParams{limit: limit, userId: params[1]}, nil
+}
+
+func evaluateIsTheOne(ctx context.Context, in PolicyInput) (bool, error) {
+	p := in.Parsed.(isTheOneParams)
+	if in.Resolver == nil {
+		return false, errors.New("resolver cannot be nil")
+	}
+	views, err := in.Resolver.GetViewerPostViewCount(ctx, in.FeedId, p.userId)
+	if err != nil {
+		return false, fmt.Errorf("failed getting user's view count on post: %w", err)
+	}
+	in.Record("viewer_views", views)
+	return views > p.limit, nil
+}
+
+// the time when the feed should start having exposure
+func evaluateInexpose(ctx context.Context, in PolicyInput) (bool, error) {
+	now := Now(ctx).Unix()
+	in.Record("now", now)
+	return now < in.Parsed.(int64), nil
+}
+
+// the time when the feed should stop having exposure
+func evaluateUnexpose(ctx context.Context, in PolicyInput) (bool, error) {
+	now := Now(ctx).Unix()
+	in.Record("now", now)
+	return now > in.Parsed.(int64), nil
+}
+
+// the target attribute which the feed should have a match
+func evaluateIstarget(ctx context.Context, in PolicyInput) (bool, error) {
+	if in.Resolver == nil {
+		return false, errors.New("resolver cannot be nil")
+	}
+	userAttrs, err := in.Resolver.GetUserAttribute(ctx, in.UserId)
+	if err != nil {
+		return false, fmt.Errorf("failed getting user attribute: %w", err)
+	}
+	in.Record("attributes", userAttrs)
+	// Every segment after the policy name is one alternative, ORed together:
+	// "istarget:cardiology:neurology" matches a user holding either. Separate
+	// istarget policies stay ANDed, so pairing it with "istarget:male" reads as
+	// (cardiology OR neurology) AND male — the shape an audience filter needs.
+	// A single-segment policy is unchanged, which is every policy written to
+	// date, so this is purely additive.
+	//
+	// Matching is case-insensitive: the validate_policies_format trigger
+	// installed by store.NewFeed only accepts [a-z0-9:._-] for the param, so a
+	// policy can never carry an upper-case attribute. Resolvers,
+	// meanwhile, return attributes verbatim from their own vocabulary (e.g.
+	// apen-api returns specialties such as "Cardiology"). Comparing verbatim
+	// would make those attributes impossible to target at all.
+	for _, target := range in.Params {
+		if slices.ContainsFunc(userAttrs, func(attr string) bool {
+			return strings.EqualFold(attr, target)
+		}) {
+			// matched - no violation, return false to next policy
+			return false, nil
+		}
+	}
+	// no attribute matches any of the target attributes, the policy is violated
+	return true, nil
+}
+
+type afterParams struct {
+	feedId string
+	delay  int64
+}
+
+func parseAfter(params []string) (any, error) {
+	p := afterParams{feedId: params[0]}
+	switch suffix := params[1:]; {
+	case len(suffix) == 0:
+	case len(suffix) == 2 && suffix[0] == Delay.String():
+		var err error
+		if p.delay, err = parseNumber(suffix[1]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unknown helper policy for policy type after")
+	}
+	return p, nil
+}
+
+// the feed the user must have viewed before this one is exposed
+func evaluateAfter(ctx context.Context, in PolicyInput) (bool, error) {
+	p := in.Parsed.(afterParams)
+	history, ok := in.Resolver.(FirstViewResolver)
+	if !ok {
+		return false, errors.New("resolver does not implement FirstViewResolver")
+	}
+	viewedAt, err := history.GetViewerPostFirstViewedAt(ctx, p.feedId, in.UserId)
+	if err != nil {
+		return false, fmt.Errorf("failed getting user's first view of prerequisite feed: %w", err)
+	}
+	now := Now(ctx).Unix()
+	in.Record("first_viewed_at", viewedAt)
+	in.Record("now", now)
+	if viewedAt <= 0 {
+		// the prerequisite has not been seen yet
+		return true, nil
+	}
+	return now < viewedAt+p.delay, nil
+}
+
+// the interval a user must wait before seeing the feed again
+func evaluateCooldown(ctx context.Context, in PolicyInput) (bool, error) {
+	history, ok := in.Resolver.(LastViewResolver)
+	if !ok {
+		return false, errors.New("resolver does not implement LastViewResolver")
+	}
+	viewedAt, err := history.GetViewerPostLastViewedAt(ctx, in.FeedId, in.UserId)
+	if err != nil {
+		return false, fmt.Errorf("failed getting user's last view on post: %w", err)
+	}
+	now := Now(ctx).Unix()
+	in.Record("last_viewed_at", viewedAt)
+	in.Record("now", now)
+	return viewedAt > 0 && now < viewedAt+in.Parsed.(int64), nil
+}
+
+type minCTRParams struct {
+	ratio          float64
+	minImpressions int64
+}
+
+func parseMinCTR(params []string) (any, error) {
+	ratio, err := strconv.ParseFloat(params[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing policy ratio %q: %w", params[0], err)
+	}
+	p := minCTRParams{ratio: ratio}
+	// minctr borrows "after" as its helper: judge the ratio only after N impressions
+	switch suffix := params[1:]; {
+	case len(suffix) == 0:
+	case len(suffix) == 2 && suffix[0] == After.String():
+		if p.minImpressions, err = parseNumber(suffix[1]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unknown helper policy for policy type minctr")
+	}
+	return p, nil
+}
+
+// the click-through ratio the feed must keep once it has enough impressions
+func evaluateMinCTR(ctx context.Context, in PolicyInput) (bool, error) {
+	p := in.Parsed.(minCTRParams)
+	clicker, ok := in.Resolver.(ClickResolver)
+	if !ok {
+		return false, errors.New("resolver does not implement ClickResolver")
+	}
+	impressions, err := in.Resolver.GetPostViewCount(ctx, in.FeedId, false, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed getting post's view count: %w", err)
+	}
+	in.Record("impressions", impressions)
+	if impressions == 0 || impressions < p.minImpressions {
+		// too early to judge
+		return false, nil
+	}
+	clicks, err := clicker.GetPostClickCount(ctx, in.FeedId)
+	if err != nil {
+		return false, fmt.Errorf("failed getting post's click count: %w", err)
+	}
+	ctr := float64(clicks) / float64(impressions)
+	in.Record("clicks", clicks)
+	in.Record("ctr", ctr)
+	return ctr < p.ratio, nil
+}
+
+// how many dismissals by a user hide the feed from them
+func evaluateDismissed(ctx context.Context, in PolicyInput) (bool, error) {
+	dismisser, ok := in.Resolver.(DismissResolver)
+	if !ok {
+		return false, errors.New("resolver does not implement DismissResolver")
+	}
+	dismissals, err := dismisser.GetViewerPostDismissCount(ctx, in.FeedId, in.UserId)
+	if err != nil {
+		return false, fmt.Errorf("failed getting user's dismiss count on post: %w", err)
+	}
+	in.Record("dismissals", dismissals)
+	return dismissals >= in.Parsed.(int64), nil
+}
+
+// the client platforms the feed is served to
+func evaluatePlatform(ctx context.Context, in PolicyInput) (bool, error) {
+	client, ok := ClientFromContext(ctx)
+	if !ok || client.Platform == "" {
+		return false, errors.New("client platform unknown")
+	}
+	in.Record("platform", client.Platform)
+	// alternatives are ORed, as with istarget: "platform:ios:android"
+	return !slices.ContainsFunc(in.Params, func(platform string) bool {
+		return strings.EqualFold(client.Platform, platform)
+	}), nil
+}
+
+func parseVersionParam(params []string) (any, error) {
+	if _, _, err := parseVersion(params[0]); err != nil {
+		return nil, err
+	}
+	return params[0], nil
+}
+
+// compareClientVersion compares the client's version against the policy's.
+func compareClientVersion(ctx context.Context, in PolicyInput) (int, error) {
+	client, ok := ClientFromContext(ctx)
+	if !ok || client.Version == "" {
+		return 0, errors.New("client version unknown")
+	}
+	in.Record("version", client.Version)
+	cmp, err := CompareVersions(client.Version, in.Parsed.(string))
+	if err != nil {
+		return 0, fmt.Errorf("failed comparing versions: %w", err)
+	}
+	return cmp, nil
+}
+
+// the lowest client app version the feed is served to
+func evaluateMinVersion(ctx context.Context, in PolicyInput) (bool, error) {
+	cmp, err := compareClientVersion(ctx, in)
+	return err == nil && cmp < 0, err
+}
+
+// the highest client app version the feed is served to
+func evaluateMaxVersion(ctx context.Context, in PolicyInput) (bool, error) {
+	cmp, err := compareClientVersion(ctx, in)
+	return err == nil && cmp > 0, err
+}
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// mockTierResolver is a host-side resolver extension used by the custom
+// "mintier" kind below.
+type mockTierResolver struct {
+	mockPolicyResolver
+	tiers map[string]int64
+}
+
+func (m *mockTierResolver) GetUserTier(ctx context.Context, userID string) (int64, error) {
+	tier, ok := m.tiers[userID]
+	if !ok {
+		return 0, errors.New("unknown user")
+	}
+	return tier, nil
+}
+
+type tierResolver interface {
+	GetUserTier(ctx context.Context, userID string) (int64, error)
+}
+
+var minTierKind = PolicyKind{
+	Name: "mintier",
+	Parse: func(params []string) (any, error) {
+		return strconv.ParseInt(params[0], 10, 64)
+	},
+	Evaluate: func(ctx context.Context, in PolicyInput) (bool, error) {
+		resolver, ok := in.Resolver.(tierResolver)
+		if !ok {
+			return false, errors.New("resolver does not implement tierResolver")
+		}
+		tier, err := resolver.GetUserTier(ctx, in.UserId)
+		if err != nil {
+			return false, err
+		}
+		in.Record("tier", tier)
+		return tier < in.Parsed.(int64), nil
+	},
+}
+
+func init() {
+	if err := RegisterPolicyKind(minTierKind); err != nil {
+		panic(err)
+	}
+}
+
+// unregisterPolicyKind drops a kind registered by a test, so that the test can
+// run again in the same process.
+func unregisterPolicyKind(name string) {
+	policyKinds.Lock()
+	defer policyKinds.Unlock()
+	delete(policyKinds.kinds, name)
+}
+
+func TestRegisterPolicyKind(t *testing.T) {
+	evaluate := func(ctx context.Context, in PolicyInput) (bool, error) { return false, nil }
+
+	tests := []struct {
+		name          string
+		kind          PolicyKind
+		expectedError bool
+	}{
+		{name: "valid kind", kind: PolicyKind{Name: "registry_test", Evaluate: evaluate}},
+		{name: "duplicate custom kind", kind: minTierKind, expectedError: true},
+		{name: "duplicate built-in kind", kind: PolicyKind{Name: "exposure", Evaluate: evaluate}, expectedError: true},
+		{name: "reserved expr", kind: PolicyKind{Name: "expr", Evaluate: evaluate}, expectedError: true},
+		{name: "upper-case name", kind: PolicyKind{Name: "MinTier", Evaluate: evaluate}, expectedError: true},
+		{name: "name with colon", kind: PolicyKind{Name: "min:tier", Evaluate: evaluate}, expectedError: true},
+		{name: "empty name", kind: PolicyKind{Evaluate: evaluate}, expectedError: true},
+		{name: "no evaluator", kind: PolicyKind{Name: "registry_test_noop"}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RegisterPolicyKind(tt.kind)
+			if err == nil {
+				t.Cleanup(func() { unregisterPolicyKind(tt.kind.Name) })
+			}
+			if tt.expectedError && err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if !tt.expectedError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPolicyKindNames(t *testing.T) {
+	names := PolicyKindNames()
+	for _, expected := range []string{"exposure", "istarget", "minversion", "mintier"} {
+		found := false
+		for _, name := range names {
+			found = found || name == expected
+		}
+		if !found {
+			t.Errorf("expected %s to be registered, got %v", expected, names)
+		}
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] > names[i] {
+			t.Errorf("expected sorted names, got %v", names)
+			break
+		}
+	}
+	if _, ok := LookupPolicyKind("expr"); ok {
+		t.Error("expr must not be a registered kind")
+	}
+}
+
+func TestCustomPolicyKind(t *testing.T) {
+	ctx := context.Background()
+	resolver := &mockTierResolver{tiers: map[string]int64{"gold": 3, "bronze": 1}}
+
+	tests := []struct {
+		name             string
+		policy           PolicyType
+		userId           string
+		resolver         PolicyResolver
+		expectedViolated bool
+	}{
+		{name: "meets tier", policy: "mintier:2", userId: "gold", resolver: resolver, expectedViolated: false},
+		{name: "below tier (violation)", policy: "mintier:2", userId: "bronze", resolver: resolver, expectedViolated: true},
+		{name: "resolver error", policy: "mintier:2", userId: "nobody", resolver: resolver, expectedViolated: false},
+		{name: "host resolver missing", policy: "mintier:2", userId: "bronze", resolver: &mockPolicyResolver{}, expectedViolated: false},
+		{name: "invalid param", policy: "mintier:high", userId: "bronze", resolver: resolver, expectedViolated: false},
+		{name: "inside an expression (violation)", policy: "expr:mintier:2 and unexpose:9999999999", userId: "bronze", resolver: resolver, expectedViolated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.policy.Violated(ctx, tt.userId, "post1", tt.resolver)
+			if result != tt.expectedViolated {
+				t.Errorf("expected violated=%v, got %v", tt.expectedViolated, result)
+			}
+		})
+	}
+
+	t.Run("explain records custom values", func(t *testing.T) {
+		result := PolicyType("mintier:2").Explain(ctx, "bronze", "post1", resolver)
+		if !result.Violated || result.Values["tier"] != int64(1) {
+			t.Errorf("unexpected result %+v", result)
+		}
+	})
+}
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		policy        string
+		expectedError bool
+	}{
+		{policy: "exposure:1000"},
+		{policy: "exposure:1000:distinct:duration:3600"},
+		{policy: "istarget:cardiology:neurology"},
+		{policy: "after:post-a:delay:3600"},
+		{policy: "minctr:0.02:after:500"},
+		{policy: "minversion:5.2.0"},
+		{policy: "mintier:2"},
+		{policy: "expr:(istarget:student or unexpose:1735689600) and exposure:1000"},
+		{policy: "exposure", expectedError: true},
+		{policy: "exposure:abc", expectedError: true},
+		{policy: "exposure:1000:duration", expectedError: true},
+		{policy: "istheone:5", expectedError: true},
+		{policy: "after:post-a:wait:10", expectedError: true},
+		{policy: "minversion:latest", expectedError: true},
+		{policy: "unknown:1", expectedError: true},
+		{policy: "mintier:high", expectedError: true},
+		{policy: "expr:istarget:a and", expectedError: true},
+		{policy: "expr:istarget:a and exposure:abc", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			err := ValidatePolicy(tt.policy)
+			if tt.expectedError && err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if !tt.expectedError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+)
+
+// Rotation decides which post serves a shared posts slot on each request, so
+// several posts grouped behind one slot holder take turns. Pick is only asked
+// when there is a choice to make: every candidate is present in the data, not
+// pinned elsewhere and not hidden by its policies.
+//
+// When Pick fails the slot falls back to the first candidate.
+type Rotation interface {
+	Pick(ctx context.Context, slot Slot) (string, error)
+}
+
+// Slot is a posts slot to be served.
+type Slot struct {
+	UserId   string
+	HolderId string
+	Position int
+	// Candidates are the posts that may serve the slot: the holder first when
+	// it is eligible, then its relation members in order. Never empty.
+	Candidates []Candidate
+	// Resolver is the service's policy resolver, nil when none is set.
+	Resolver PolicyResolver
+}
+
+// Candidate is a post that may serve a slot.
+type Candidate struct {
+	FeedId string
+	// Weight is the candidate's share under RotationWeightedRandom: the
+	// relation weight for members, 1 for the holder.
+	Weight float64
+}
+
+// Built-in rotations.
+var (
+	// RotationFixed serves the first candidate: the holder while it is
+	// eligible, then its members in order. It is the default.
+	RotationFixed Rotation = fixedRotation{}
+	// RotationRoundRobin serves each user the candidate they have viewed the
+	// least (GetViewerPostViewCount), so a user cycles through the group as
+	// views are recorded. Ties go to the earlier candidate.
+	RotationRoundRobin Rotation = roundRobinRotation{}
+	// RotationWeightedRandom picks a candidate at random, proportionally to
+	// its weight.
+	RotationWeightedRandom Rotation = weightedRandomRotation{}
+	// RotationLeastExposed serves the candidate with the fewest total views
+	// (GetPostViewCount), evening out exposure across the group. Ties go to
+	// the earlier candidate.
+	RotationLeastExposed Rotation = leastExposedRotation{}
+	// RotationSticky always serves a user the same candidate, spreading users
+	// evenly across the group. Adding or removing a candidate only moves the
+	// users it gains or loses.
+	RotationSticky Rotation = stickyRotation{}
+)
+
+var errNoCandidates = errors.New("slot has no candidates")
+
+var errNoResolver = errors.New("rotation requires a policy resolver")
+
+type fixedRotation struct{}
+
+func (fixedRotation) Pick(ctx context.Context, slot Slot) (string, error) {
+	if len(slot.Candidates) == 0 {
+		return "", errNoCandidates
+	}
+	return slot.Candidates[0].FeedId, nil
+}
+
+type roundRobinRotation struct{}
+
+func (roundRobinRotation) Pick(ctx context.Context, slot Slot) (string, error) {
+	if slot.Resolver == nil {
+		return "", errNoResolver
+	}
+	return pickFewest(slot.Candidates, func(feedID string) (int64, error) {
+		return slot.Resolver.GetViewerPostViewCount(ctx, feedID, slot.UserId)
+	})
+}
+
+type leastExposedRotation struct{}
+
+func (leastExposedRotation) Pick(ctx context.Context, slot Slot) (string, error) {
+	if slot.Resolver == nil {
+		return "", errNoResolver
+	}
+	return pickFewest(slot.Candidates, func(feedID string) (int64, error) {
+		return slot.Resolver.GetPostViewCount(ctx, feedID, false, 0)
+	})
+}
+
+// pickFewest returns the first candidate with the lowest count.
+func pickFewest(candidates []Candidate, count func(feedID string) (int64, error)) (string, error) {
+	if len(candidates) == 0 {
+		return "", errNoCandidates
+	}
+	best, fewest := "", int64(0)
+	for _, candidate := range candidates {
+		n, err := count(candidate.FeedId)
+		if err != nil {
+			return "", err
+		}
+		if best == "" || n < fewest {
+			best, fewest = candidate.FeedId, n
+		}
+	}
+	return best, nil
+}
+
+type weightedRandomRotation struct{}
+
+func (weightedRandomRotation) Pick(ctx context.Context, slot Slot) (string, error) {
+	if len(slot.Candidates) == 0 {
+		return "", errNoCandidates
+	}
+	var total float64
+	for _, candidate := range slot.Candidates {
+		if candidate.Weight > 0 {
+			total += candidate.Weight
+		}
+	}
+	if total == 0 {
+		return "", errors.New("no candidate has a positive weight")
+	}
+	r := rand.Float64() * total
+	for _, candidate := range slot.Candidates {
+		if candidate.Weight <= 0 {
+			continue
+		}
+		if r < candidate.Weight {
+			return candidate.FeedId, nil
+		}
+		r -= candidate.Weight
+	}
+	// floating point leftovers land on the last weighted candidate
+	for i := len(slot.Candidates) - 1; i >= 0; i-- {
+		if slot.Candidates[i].Weight > 0 {
+			return slot.Candidates[i].FeedId, nil
+		}
+	}
+	return "", errNoCandidates
+}
+
+type stickyRotation struct{}
+
+// Pick uses rendezvous hashing: every (user, slot, candidate) triple gets a
+// score and the highest wins.
+func (stickyRotation) Pick(ctx context.Context, slot Slot) (string, error) {
+	if len(slot.Candidates) == 0 {
+		return "", errNoCandidates
+	}
+	best, highest := "", uint64(0)
+	for _, candidate := range slot.Candidates {
+		h := fnv.New64a()
+		h.Write([]byte(slot.UserId + "/" + slot.HolderId + "/" + candidate.FeedId))
+		if score := h.Sum64(); best == "" || score > highest {
+			best, highest = candidate.FeedId, score
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,182 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type mockRotationResolver struct {
+	views       map[string]int64
+	viewerViews map[string]int64
+	err         error
+}
+
+func (m *mockRotationResolver) GetPostViewCount(ctx context.Context, postID string, uniqueUser bool, duration int64) (int64, error) {
+	return m.views[postID], m.err
+}
+
+func (m *mockRotationResolver) GetViewerPostViewCount(ctx context.Context, postID, userID string) (int64, error) {
+	return m.viewerViews[userID+"/"+postID], m.err
+}
+
+func (m *mockRotationResolver) GetUserAttribute(ctx context.Context, userID string) ([]string, error) {
+	return nil, m.err
+}
+
+func candidates(ids ...string) []Candidate {
+	c := make([]Candidate, len(ids))
+	for i, id := range ids {
+		c[i] = Candidate{FeedId: id, Weight: 1}
+	}
+	return c
+}
+
+func TestRotationPick(t *testing.T) {
+	ctx := context.Background()
+	resolver := &mockRotationResolver{
+		views:       map[string]int64{"a": 30, "b": 10, "c": 10},
+		viewerViews: map[string]int64{"user1/a": 2, "user1/b": 1, "user1/c": 2},
+	}
+
+	tests := []struct {
+		name      string
+		rotation  Rotation
+		slot      Slot
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "fixed serves the first candidate",
+			rotation: RotationFixed,
+			slot:     Slot{Candidates: candidates("a", "b", "c")},
+			expected: "a",
+		},
+		{
+			name:     "round robin serves what the user saw least",
+			rotation: RotationRoundRobin,
+			slot:     Slot{UserId: "user1", Candidates: candidates("a", "b", "c"), Resolver: resolver},
+			expected: "b",
+		},
+		{
+			name:     "round robin starts a new user at the first candidate",
+			rotation: RotationRoundRobin,
+			slot:     Slot{UserId: "user2", Candidates: candidates("a", "b", "c"), Resolver: resolver},
+			expected: "a",
+		},
+		{
+			name:      "round robin needs a resolver",
+			rotation:  RotationRoundRobin,
+			slot:      Slot{UserId: "user1", Candidates: candidates("a", "b")},
+			expectErr: true,
+		},
+		{
+			name:     "least exposed breaks ties by order",
+			rotation: RotationLeastExposed,
+			slot:     Slot{Candidates: candidates("a", "b", "c"), Resolver: resolver},
+			expected: "b",
+		},
+		{
+			name:      "least exposed resolver error",
+			rotation:  RotationLeastExposed,
+			slot:      Slot{Candidates: candidates("a", "b"), Resolver: &mockRotationResolver{err: errors.New("boom")}},
+			expectErr: true,
+		},
+		{
+			name:     "weighted random skips zero weights",
+			rotation: RotationWeightedRandom,
+			slot:     Slot{Candidates: []Candidate{{FeedId: "a"}, {FeedId: "b", Weight: 2}, {FeedId: "c"}}},
+			expected: "b",
+		},
+		{
+			name:      "weighted random without weights",
+			rotation:  RotationWeightedRandom,
+			slot:      Slot{Candidates: []Candidate{{FeedId: "a"}, {FeedId: "b"}}},
+			expectErr: true,
+		},
+		{
+			name:      "no candidates",
+			rotation:  RotationSticky,
+			slot:      Slot{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rotation.Pick(ctx, tt.slot)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRotationWeightedRandomDistribution(t *testing.T) {
+	ctx := context.Background()
+	slot := Slot{Candidates: []Candidate{{FeedId: "a", Weight: 1}, {FeedId: "b", Weight: 3}}}
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		picked, err := RotationWeightedRandom.Pick(ctx, slot)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		counts[picked]++
+	}
+	// expect roughly 1000 vs 3000
+	if counts["a"] < 700 || counts["a"] > 1300 {
+		t.Errorf("weights not respected: %v", counts)
+	}
+}
+
+func TestRotationSticky(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("same user, same candidate", func(t *testing.T) {
+		slot := Slot{UserId: "user1", HolderId: "holder", Candidates: candidates("a", "b", "c")}
+		first, err := RotationSticky.Pick(ctx, slot)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			if got, _ := RotationSticky.Pick(ctx, slot); got != first {
+				t.Fatalf("expected %q on every pick, got %q", first, got)
+			}
+		}
+	})
+
+	t.Run("users spread across candidates", func(t *testing.T) {
+		counts := map[string]int{}
+		for i := 0; i < 300; i++ {
+			slot := Slot{UserId: "user" + string(rune('a'+i%26)) + string(rune('a'+i/26)), HolderId: "holder", Candidates: candidates("a", "b", "c")}
+			picked, _ := RotationSticky.Pick(ctx, slot)
+			counts[picked]++
+		}
+		for _, id := range []string{"a", "b", "c"} {
+			if counts[id] < 50 {
+				t.Errorf("candidate %q under-served: %v", id, counts)
+			}
+		}
+	})
+
+	t.Run("removing a candidate only moves its users", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			user := "user" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+			before, _ := RotationSticky.Pick(ctx, Slot{UserId: user, HolderId: "holder", Candidates: candidates("a", "b", "c")})
+			after, _ := RotationSticky.Pick(ctx, Slot{UserId: user, HolderId: "holder", Candidates: candidates("a", "b")})
+			if before != "c" && before != after {
+				t.Errorf("user %s moved from %q to %q", user, before, after)
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"cmp"
+	"context"
+	"hash/fnv"
+	"sort"
+)
+
+// TieBreaker orders two feeds of equal score: negative puts a first, positive
+// puts b first, zero leaves the tie to the next tie breaker.
+type TieBreaker func(ctx context.Context, a, b Scorable) int
+
+// SecondaryScored is implemented by feed data that carries a second ranking
+// signal, such as a creation time, for TieBreakSecondary. It is optional.
+type SecondaryScored interface {
+	SecondaryScore() float64
+}
+
+// Built-in tie breakers.
+var (
+	// TieBreakSecondary puts the higher SecondaryScore first. Ties with data
+	// that is not SecondaryScored are left undecided.
+	TieBreakSecondary TieBreaker = tieBreakSecondary
+	// TieBreakUserHash orders by a hash of the id seeded with the user in
+	// USER_ID_KEY: a user always gets the same order, while equal feeds are
+	// spread evenly across users.
+	TieBreakUserHash TieBreaker = tieBreakUserHash
+	// TieBreakID puts the lower id first.
+	TieBreakID TieBreaker = tieBreakID
+)
+
+func tieBreakSecondary(ctx context.Context, a, b Scorable) int {
+	sa, ok := a.(SecondaryScored)
+	if !ok {
+		return 0
+	}
+	sb, ok := b.(SecondaryScored)
+	if !ok {
+		return 0
+	}
+	return cmp.Compare(sb.SecondaryScore(), sa.SecondaryScore())
+}
+
+func tieBreakUserHash(ctx context.Context, a, b Scorable) int {
+	userID, _ := ctx.Value(USER_ID_KEY).(string)
+	return cmp.Compare(userHash(userID, a.GetID()), userHash(userID, b.GetID()))
+}
+
+func userHash(userID, feedID string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(userID + "/" + feedID))
+	return h.Sum64()
+}
+
+func tieBreakID(ctx context.Context, a, b Scorable) int {
+	return cmp.Compare(a.GetID(), b.GetID())
+}
+
+// BreakTie runs chain in order and returns the first decision, or zero when
+// every tie breaker leaves the tie.
+func BreakTie(ctx context.Context, chain []TieBreaker, a, b Scorable) int {
+	for _, tieBreaker := range chain {
+		if c := tieBreaker(ctx, a, b); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// SortWith sorts like Sort, breaking ties between equal scores with chain.
+// Ties chain leaves keep their order.
+func (f Feeds[T]) SortWith(ctx context.Context, chain ...TieBreaker) {
+	sort.SliceStable(f, func(i, j int) bool {
+		if greater(f[i].Data, f[j].Data) {
+			return true
+		}
+		if greater(f[j].Data, f[i].Data) {
+			return false
+		}
+		return BreakTie(ctx, chain, f[i].Data, f[j].Data) < 0
+	})
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"context"
+	"testing"
+)
+
+type secondaryPost struct {
+	MockPost
+	secondary float64
+}
+
+func (s secondaryPost) SecondaryScore() float64 {
+	return s.secondary
+}
+
+func TestFeedsSortWith(t *testing.T) {
+	userCtx := func(userID string) context.Context {
+		return context.WithValue(context.Background(), USER_ID_KEY, userID)
+	}
+	feed := func(id string, score, secondary float64) Feed[secondaryPost] {
+		return Feed[secondaryPost]{ID: id, Type: TypePost, Data: secondaryPost{MockPost: MockPost{id: id, score: score}, secondary: secondary}}
+	}
+	ids := func(feeds Feeds[secondaryPost]) []string {
+		out := make([]string, len(feeds))
+		for i, feed := range feeds {
+			out[i] = feed.ID
+		}
+		return out
+	}
+	sorted := func(ctx context.Context, chain []TieBreaker, feeds ...Feed[secondaryPost]) []string {
+		f := Feeds[secondaryPost](feeds)
+		f.SortWith(ctx, chain...)
+		return ids(f)
+	}
+	equal := func(a, b []string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	t.Run("no chain keeps the order of ties", func(t *testing.T) {
+		got := sorted(context.Background(), nil, feed("b", 1, 0), feed("c", 2, 0), feed("a", 1, 0))
+		if expected := []string{"c", "b", "a"}; !equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("secondary score then id", func(t *testing.T) {
+		chain := []TieBreaker{TieBreakSecondary, TieBreakID}
+		got := sorted(context.Background(), chain, feed("d", 1, 5), feed("b", 1, 9), feed("c", 2, 0), feed("a", 1, 5))
+		if expected := []string{"c", "b", "a", "d"}; !equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("score comes before the chain", func(t *testing.T) {
+		got := sorted(context.Background(), []TieBreaker{TieBreakID}, feed("a", 1, 0), feed("b", 2, 0))
+		if expected := []string{"b", "a"}; !equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("user hash is independent of the input order", func(t *testing.T) {
+		chain := []TieBreaker{TieBreakUserHash}
+		input := []Feed[secondaryPost]{feed("a", 1, 0), feed("b", 1, 0), feed("c", 1, 0), feed("d", 1, 0), feed("e", 1, 0)}
+		reversed := make([]Feed[secondaryPost], len(input))
+		for i := range input {
+			reversed[len(input)-1-i] = input[i]
+		}
+
+		first := sorted(userCtx("user1"), chain, input...)
+		if second := sorted(userCtx("user1"), chain, reversed...); !equal(first, second) {
+			t.Errorf("expected the same order for the same user, got %v and %v", first, second)
+		}
+
+		// some user out of a few gets another order
+		differs := false
+		for _, userID := range []string{"user2", "user3", "user4", "user5"} {
+			if !equal(first, sorted(userCtx(userID), chain, input...)) {
+				differs = true
+			}
+		}
+		if !differs {
+			t.Errorf("expected users to get different orders, all got %v", first)
+		}
+	})
+}
+
+func TestBreakTie(t *testing.T) {
+	ctx := context.Background()
+	a, b := MockPost{id: "a"}, MockPost{id: "b"}
+
+	if c := BreakTie(ctx, nil, a, b); c != 0 {
+		t.Errorf("expected an empty chain to leave the tie, got %d", c)
+	}
+	if c := BreakTie(ctx, []TieBreaker{TieBreakSecondary}, a, b); c != 0 {
+		t.Errorf("expected data without a secondary score to leave the tie, got %d", c)
+	}
+	if c := BreakTie(ctx, []TieBreaker{TieBreakSecondary, TieBreakID}, b, a); c <= 0 {
+		t.Errorf("expected the id to decide, got %d", c)
+	}
+}
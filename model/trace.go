@@ -0,0 +1,54 @@
+package model
+
+// Trace records how a feed was assembled, for logging or debugging. Set a
+// *Trace under TRACE_KEY to have GetFeeds fill it in.
+type Trace struct {
+	// Feeds holds a FeedTrace for every feed of the data and every backfilled
+	// feed: the served ones in served order, then the removed ones in data
+	// order.
+	Feeds []FeedTrace `json:"feeds"`
+}
+
+// FeedTrace is how one feed ended up where it is.
+type FeedTrace struct {
+	FeedId string `json:"id"`
+	// Rank is the index of the feed once sorted by score, and Score the score
+	// it was sorted by (see ScoreStage). Without a sorting stage, Rank is the
+	// index in data; backfilled feeds have none and get -1.
+	Rank  int     `json:"rank"`
+	Score float64 `json:"score"`
+	// Position is the served index, -1 when the feed was removed.
+	Position int `json:"position"`
+
+	// Pin is the pin that placed the feed, nil when it was not pinned.
+	Pin *Policy `json:"pin,omitempty"`
+	// HolderId is set when the feed was served in the posts slot of another
+	// feed, the slot holder Pin was read from.
+	HolderId string `json:"holder_id,omitempty"`
+	// Coldstart is set when the feed was inserted as a coldstart feed, from
+	// Audience: the coldstart table audience, or COLD_START_AUDIENCE_KEY when
+	// the caller supplied the set.
+	Coldstart bool   `json:"coldstart,omitempty"`
+	Audience  string `json:"audience,omitempty"`
+	// Backfilled is set when the feed was not in the data but pulled from the
+	// backfill source to fill a pin gap.
+	Backfilled bool `json:"backfilled,omitempty"`
+	// ShiftedBy counts the pinned and coldstart feeds inserted before the
+	// feed, pushing it down.
+	ShiftedBy int `json:"shifted_by,omitempty"`
+
+	// RemovedBy is why the feed is not served: the relation policy it
+	// violates, "pin gap" for a pin dropped past the end of the feed, or the
+	// pipeline stage that dropped it.
+	RemovedBy string `json:"removed_by,omitempty"`
+}
+
+// Feed returns the trace of feedID, or nil when there is none.
+func (t *Trace) Feed(feedID string) *FeedTrace {
+	for i := range t.Feeds {
+		if t.Feeds[i].FeedId == feedID {
+			return &t.Feeds[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+
+	"github.com/A-pen-app/feed-sdk/model"
+	"github.com/A-pen-app/logging"
+)
+
+// Backfill is a source of extra feeds, pulled from when there are too few
+// feeds in the data to reach a pin (see model.PinGapBackfill). Serving
+// placeholders is a matter of returning them from Backfill.
+type Backfill[T model.Scorable] interface {
+	// Backfill returns up to n feeds, in the order they are to be served,
+	// none of them with an id in exclude.
+	Backfill(ctx context.Context, n int, exclude []string) ([]T, error)
+}
+
+// WithPinGaps sets what GetFeeds does with pins past the end of the feed.
+// Defaults to model.PinGapAppend.
+func WithPinGaps(gap model.PinGap) Option {
+	return func(o *options) {
+		o.pinGap = gap
+	}
+}
+
+// SetBackfill sets the source model.PinGapBackfill pulls feeds from. Like
+// SetPipeline, it must not be called while GetFeeds is running.
+func (f *Service[T]) SetBackfill(backfill Backfill[T]) {
+	f.backfill = backfill
+}
+
+// fillGaps handles the pins that lie past the end of feeds, the feeds that are
+// not pinned, according to the pin gap setting. placements are by ascending
+// index, as placePins returns them; pinned holds the pinned feeds by id.
+func (f *Service[T]) fillGaps(ctx context.Context, feeds model.Feeds[T], placements []placement, pinned map[string]model.Feed[T]) (model.Feeds[T], []placement) {
+	if len(placements) == 0 {
+		return feeds, placements
+	}
+	// pins are inserted by ascending index, so the last one is the furthest
+	// out of reach
+	missing := placements[len(placements)-1].index + 1 - len(placements) - len(feeds)
+	if missing <= 0 {
+		return feeds, placements
+	}
+
+	t := tracerFrom(ctx)
+	switch f.pinGap {
+	case model.PinGapDrop:
+		kept := placements[:0:0]
+		for _, p := range placements {
+			if p.index > len(feeds)+len(kept) {
+				t.removed(p.feedID, "pin gap")
+				continue
+			}
+			kept = append(kept, p)
+		}
+		return feeds, kept
+
+	case model.PinGapBackfill:
+		if f.backfill == nil {
+			return feeds, placements
+		}
+		exclude := make([]string, 0, len(feeds)+len(pinned))
+		excluded := make(map[string]bool, cap(exclude))
+		for _, feed := range feeds {
+			exclude, excluded[feed.ID] = append(exclude, feed.ID), true
+		}
+		for id := range pinned {
+			exclude, excluded[id] = append(exclude, id), true
+		}
+		extra, err := f.backfill.Backfill(ctx, missing, exclude)
+		if err != nil {
+			logging.Errorw(ctx, "backfill failed, appending pins past the end", "missing", missing, "err", err)
+			return feeds, placements
+		}
+		for _, d := range extra {
+			if missing == 0 {
+				break
+			}
+			if excluded[d.GetID()] {
+				continue
+			}
+			excluded[d.GetID()] = true
+			feed := model.Feed[T]{ID: d.GetID(), Type: d.Feedtype(), Data: d}
+			feeds = append(feeds, feed)
+			backfilled(t, feed)
+			missing--
+		}
+	}
+	return feeds, placements
+}
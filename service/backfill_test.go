@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+type mockBackfill struct {
+	feeds   []MockPost
+	err     error
+	n       int
+	exclude []string
+}
+
+func (m *mockBackfill) Backfill(ctx context.Context, n int, exclude []string) ([]MockPost, error) {
+	m.n, m.exclude = n, exclude
+	return m.feeds, m.err
+}
+
+func TestGetFeeds_PinGaps(t *testing.T) {
+	data := []MockPost{
+		{id: "post1", feedType: model.TypePost, score: 90},
+		{id: "post2", feedType: model.TypePost, score: 80},
+		{id: "post3", feedType: model.TypePost, score: 70},
+		{id: "banner", feedType: model.TypeBanners, score: 1},
+		{id: "chat", feedType: model.TypeChat, score: 1},
+	}
+	pins := []model.Policy{
+		{FeedId: "chat", FeedType: model.TypeChat, Position: 1},
+		{FeedId: "banner", FeedType: model.TypeBanners, Position: 8},
+	}
+
+	tests := []struct {
+		name         string
+		gap          model.PinGap
+		backfill     *mockBackfill
+		expected     []string
+		expectedN    int
+		expectedExcl int
+	}{
+		{
+			name:     "append by default",
+			expected: []string{"post1", "chat", "post2", "post3", "banner"},
+		},
+		{
+			name:     "drop",
+			gap:      model.PinGapDrop,
+			expected: []string{"post1", "chat", "post2", "post3"},
+		},
+		{
+			name: "backfill",
+			gap:  model.PinGapBackfill,
+			backfill: &mockBackfill{feeds: []MockPost{
+				{id: "post2"}, // already served
+				{id: "extra1"}, {id: "extra2"}, {id: "extra3"}, {id: "extra4"}, {id: "extra5"}, {id: "extra6"},
+			}},
+			expected:     []string{"post1", "chat", "post2", "post3", "extra1", "extra2", "extra3", "extra4", "banner"},
+			expectedN:    4,
+			expectedExcl: 5,
+		},
+		{
+			name:         "short backfill appends",
+			gap:          model.PinGapBackfill,
+			backfill:     &mockBackfill{feeds: []MockPost{{id: "extra1"}}},
+			expected:     []string{"post1", "chat", "post2", "post3", "extra1", "banner"},
+			expectedN:    4,
+			expectedExcl: 5,
+		},
+		{
+			name:         "failed backfill appends",
+			gap:          model.PinGapBackfill,
+			backfill:     &mockBackfill{err: errors.New("backfill error")},
+			expected:     []string{"post1", "chat", "post2", "post3", "banner"},
+			expectedN:    4,
+			expectedExcl: 5,
+		},
+		{
+			name:     "backfill without a source appends",
+			gap:      model.PinGapBackfill,
+			expected: []string{"post1", "chat", "post2", "post3", "banner"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.gap != "" {
+				opts = append(opts, WithPinGaps(tt.gap))
+			}
+			svc := NewFeed[MockPost](&mockStore{policies: pins}, opts...)
+			if tt.backfill != nil {
+				svc.SetBackfill(tt.backfill)
+			}
+
+			feeds, err := svc.GetFeeds(context.Background(), data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := pageIDs(feeds); !equalIDs(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if tt.backfill != nil {
+				if tt.backfill.n != tt.expectedN {
+					t.Errorf("expected %d feeds to be asked for, got %d", tt.expectedN, tt.backfill.n)
+				}
+				if len(tt.backfill.exclude) != tt.expectedExcl {
+					t.Errorf("expected %d ids excluded, got %v", tt.expectedExcl, tt.backfill.exclude)
+				}
+			}
+		})
+	}
+
+	t.Run("backfill is not asked without a gap", func(t *testing.T) {
+		backfill := &mockBackfill{}
+		svc := NewFeed[MockPost](&mockStore{policies: pins[:1]}, WithPinGaps(model.PinGapBackfill))
+		svc.SetBackfill(backfill)
+
+		if _, err := svc.GetFeeds(context.Background(), data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if backfill.n != 0 {
+			t.Errorf("expected no backfill, got asked for %d", backfill.n)
+		}
+	})
+
+	t.Run("trace", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{policies: pins}, WithPinGaps(model.PinGapDrop))
+		trace := &model.Trace{}
+		ctx := context.WithValue(context.Background(), model.TRACE_KEY, trace)
+		if _, err := svc.GetFeeds(ctx, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if banner := trace.Feed("banner"); banner.RemovedBy != "pin gap" || banner.Position != -1 {
+			t.Errorf("unexpected banner trace %+v", banner)
+		}
+
+		svc = NewFeed[MockPost](&mockStore{policies: pins}, WithPinGaps(model.PinGapBackfill))
+		svc.SetBackfill(&mockBackfill{feeds: []MockPost{{id: "extra1"}}})
+		if _, err := svc.GetFeeds(ctx, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if extra := trace.Feed("extra1"); extra == nil || !extra.Backfilled || extra.Position != 4 || extra.Rank != -1 {
+			t.Errorf("unexpected extra1 trace %+v", extra)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// PageCache keeps the feed list assembled for a first page, so that
+// GetFeedsPage serves the following pages from it instead of assembling
+// again. Values are opaque to the cache. Implementations must be safe for
+// concurrent use.
+type PageCache interface {
+	Get(ctx context.Context, key string) (any, bool)
+	Set(ctx context.Context, key string, value any)
+	// Purge drops every entry. It is called whenever the layout changes.
+	Purge(ctx context.Context)
+}
+
+// WithPageCache makes GetFeedsPage keep assembled lists in cache and issue
+// short cursors referring to them. Without one, cursors carry the list
+// themselves.
+func WithPageCache(cache PageCache) Option {
+	return func(o *options) {
+		o.pageCache = cache
+	}
+}
+
+// NewLRUPageCache returns an in-process PageCache holding at most capacity
+// lists, evicting the least recently used. Entries older than ttl are
+// dropped; a ttl of 0 keeps them until evicted.
+func NewLRUPageCache(capacity int, ttl time.Duration) PageCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &lruPageCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+type lruPageCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	order    *list.List // front is the most recently used
+	now      func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func (c *lruPageCache) Get(ctx context.Context, key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *lruPageCache) Set(ctx context.Context, key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = c.now().Add(c.ttl)
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value = &lruEntry{key: key, value: value, expires: expires}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruPageCache) Purge(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// InvalidatePages drops every cached page list, so the next page requests
+// fail with ErrInvalidCursor and clients start over on the new layout. The
+// service calls it after each layout change it makes itself; call it after
+// changing the feed tables by other means, such as another process.
+func (f *Service[T]) InvalidatePages(ctx context.Context) {
+	if f.pageCache != nil {
+		f.pageCache.Purge(ctx)
+	}
+}
+
+// invalidated invalidates the cached pages when a layout change succeeded.
+func (f *Service[T]) invalidated(ctx context.Context, err error) error {
+	if err == nil {
+		f.InvalidatePages(ctx)
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+func TestLRUPageCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("evicts the least recently used", func(t *testing.T) {
+		cache := NewLRUPageCache(2, 0)
+		cache.Set(ctx, "a", 1)
+		cache.Set(ctx, "b", 2)
+		cache.Get(ctx, "a")
+		cache.Set(ctx, "c", 3)
+
+		if _, ok := cache.Get(ctx, "b"); ok {
+			t.Error("expected b to be evicted")
+		}
+		for key, want := range map[string]int{"a": 1, "c": 3} {
+			if got, ok := cache.Get(ctx, key); !ok || got != want {
+				t.Errorf("%s: expected %d, got %v (%v)", key, want, got, ok)
+			}
+		}
+	})
+
+	t.Run("entries expire after ttl", func(t *testing.T) {
+		cache := NewLRUPageCache(2, time.Minute).(*lruPageCache)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache.now = func() time.Time { return now }
+
+		cache.Set(ctx, "a", 1)
+		now = now.Add(59 * time.Second)
+		if _, ok := cache.Get(ctx, "a"); !ok {
+			t.Fatal("expected a before its ttl")
+		}
+		now = now.Add(time.Second)
+		if _, ok := cache.Get(ctx, "a"); ok {
+			t.Error("expected a to expire")
+		}
+	})
+
+	t.Run("purge drops everything", func(t *testing.T) {
+		cache := NewLRUPageCache(2, 0)
+		cache.Set(ctx, "a", 1)
+		cache.Purge(ctx)
+		if _, ok := cache.Get(ctx, "a"); ok {
+			t.Error("expected a to be purged")
+		}
+		cache.Set(ctx, "b", 2)
+		if _, ok := cache.Get(ctx, "b"); !ok {
+			t.Error("expected the cache to be usable after a purge")
+		}
+	})
+}
+
+func TestGetFeedsPage_Cached(t *testing.T) {
+	ctx := context.WithValue(context.Background(), model.USER_ID_KEY, "user1")
+	data := []MockPost{
+		{id: "post1", feedType: model.TypePost, score: 90},
+		{id: "post2", feedType: model.TypePost, score: 80},
+		{id: "post3", feedType: model.TypePost, score: 70},
+		{id: "post4", feedType: model.TypePost, score: 60},
+		{id: "post5", feedType: model.TypePost, score: 50},
+	}
+
+	t.Run("later pages are served from the cache", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{}, WithPageCache(NewLRUPageCache(10, 0)))
+
+		page, cursor, err := svc.GetFeedsPage(ctx, data, "", 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(page); !equalIDs(got, []string{"post1", "post2"}) {
+			t.Fatalf("unexpected first page %v", got)
+		}
+
+		second, next, err := svc.GetFeedsPage(ctx, nil, cursor, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(second); !equalIDs(got, []string{"post3", "post4"}) {
+			t.Fatalf("unexpected second page %v", got)
+		}
+
+		// a cursor may be replayed
+		again, _, err := svc.GetFeedsPage(ctx, nil, cursor, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(again); !equalIDs(got, pageIDs(second)) {
+			t.Fatalf("expected the same page again, got %v", got)
+		}
+
+		last, next, err := svc.GetFeedsPage(ctx, nil, next, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(last); !equalIDs(got, []string{"post5"}) {
+			t.Fatalf("unexpected last page %v", got)
+		}
+		if next != "" {
+			t.Errorf("expected an empty cursor at the end, got %q", next)
+		}
+	})
+
+	t.Run("appending to a page leaves the cache alone", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{}, WithPageCache(NewLRUPageCache(10, 0)))
+
+		page, cursor, err := svc.GetFeedsPage(ctx, data, "", 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = append(page, model.Feed[MockPost]{ID: "ad", Data: MockPost{id: "ad"}})
+
+		second, _, err := svc.GetFeedsPage(ctx, nil, cursor, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(second); !equalIDs(got, []string{"post3", "post4"}) {
+			t.Errorf("unexpected second page %v", got)
+		}
+	})
+
+	t.Run("cursors are scoped to the user", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{}, WithPageCache(NewLRUPageCache(10, 0)))
+
+		_, cursor, err := svc.GetFeedsPage(ctx, data, "", 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		other := context.WithValue(context.Background(), model.USER_ID_KEY, "user2")
+		if _, _, err := svc.GetFeedsPage(other, nil, cursor, 2); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected ErrInvalidCursor, got %v", err)
+		}
+	})
+
+	t.Run("cached cursor without a cache", func(t *testing.T) {
+		cached := NewFeed[MockPost](&mockStore{}, WithPageCache(NewLRUPageCache(10, 0)))
+		_, cursor, err := cached.GetFeedsPage(ctx, data, "", 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		svc := NewFeed[MockPost](&mockStore{})
+		if _, _, err := svc.GetFeedsPage(ctx, data, cursor, 2); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected ErrInvalidCursor, got %v", err)
+		}
+	})
+
+	invalidations := map[string]func(svc *Service[MockPost]) error{
+		"PatchFeed": func(svc *Service[MockPost]) error {
+			return svc.PatchFeed(ctx, "post5", model.TypePost, 0)
+		},
+		"DeleteFeed": func(svc *Service[MockPost]) error {
+			return svc.DeleteFeed(ctx, "post5")
+		},
+		"SetRelationWeight": func(svc *Service[MockPost]) error {
+			return svc.SetRelationWeight(ctx, "post5", "post1", 2)
+		},
+		"InvalidatePages": func(svc *Service[MockPost]) error {
+			svc.InvalidatePages(ctx)
+			return nil
+		},
+	}
+	for name, invalidate := range invalidations {
+		t.Run(name+" invalidates cursors", func(t *testing.T) {
+			svc := NewFeed[MockPost](&mockStore{}, WithPageCache(NewLRUPageCache(10, 0)))
+
+			_, cursor, err := svc.GetFeedsPage(ctx, data, "", 2)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := invalidate(svc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, _, err := svc.GetFeedsPage(ctx, nil, cursor, 2); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+
+	t.Run("failed changes keep cursors", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{patchErr: errors.New("database error")}, WithPageCache(NewLRUPageCache(10, 0)))
+
+		_, cursor, err := svc.GetFeedsPage(ctx, data, "", 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := svc.PatchFeed(ctx, "post5", model.TypePost, 0); err == nil {
+			t.Fatal("expected error but got none")
+		}
+		if _, _, err := svc.GetFeedsPage(ctx, nil, cursor, 2); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
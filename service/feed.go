@@ -2,9 +2,8 @@ package service
 
 import (
 	"context"
-	"math/rand"
-	"slices"
-	"sort"
+	"database/sql"
+	"errors"
 	"sync"
 
 	"github.com/A-pen-app/feed-sdk/model"
@@ -12,34 +11,112 @@ import (
 	"github.com/lib/pq"
 )
 
-func NewFeed[T model.Scorable](s store) *Service[T] {
-	return &Service[T]{
+func NewFeed[T model.Scorable](s store, opts ...Option) *Service[T] {
+	f := &Service[T]{
 		store: s,
 	}
+	for _, opt := range opts {
+		opt(&f.options)
+	}
+	return f
 }
 
 type Service[T model.Scorable] struct {
-	store store
+	store    store
+	pipeline []Reranker[T]
+	backfill Backfill[T]
+	options
+}
+
+// Option configures a Service at construction time.
+type Option func(*options)
+
+type options struct {
+	resolver  model.PolicyResolver
+	rotation  model.Rotation
+	pageCache PageCache
+	diversity model.Diversity
+	scoring   model.Scoring
+	tieBreak  []model.TieBreaker
+	pinGap    model.PinGap
+}
+
+// WithPolicyResolver sets the resolver GetFeeds evaluates relation member
+// policies with, and ExplainPolicies explains them with. Without one, member
+// policies do not take effect.
+func WithPolicyResolver(resolver model.PolicyResolver) Option {
+	return func(o *options) {
+		o.resolver = resolver
+	}
+}
+
+// WithRotation sets how GetFeeds chooses among the eligible posts of a shared
+// posts slot. Defaults to model.RotationFixed.
+func WithRotation(rotation model.Rotation) Option {
+	return func(o *options) {
+		o.rotation = rotation
+	}
+}
+
+// WithDiversity sets the type diversity rules DiversityStage reorders the
+// scored feeds by. Pinned and coldstart feeds are not subject to them.
+func WithDiversity(diversity model.Diversity) Option {
+	return func(o *options) {
+		o.diversity = diversity
+	}
+}
+
+// WithTieBreakers sets how the sorting stages order feeds of equal score:
+// each tie breaker in turn, then the order of data. For instance
+//
+//	WithTieBreakers(model.TieBreakSecondary, model.TieBreakUserHash)
+//
+// serves a user the same order for the same data, whatever order the data
+// comes in.
+func WithTieBreakers(chain ...model.TieBreaker) Option {
+	return func(o *options) {
+		o.tieBreak = chain
+	}
 }
 
 type store interface {
 	GetPolicies(ctx context.Context) ([]model.Policy, error)
+	GetPolicy(ctx context.Context, feedID string) (*model.Policy, error)
 	GetColdstart(ctx context.Context) ([]model.Policy, error)
 	GetColdstartByAudience(ctx context.Context, audience string) ([]model.Policy, error)
 	GetColdstartBySpecialty(ctx context.Context, specialties []string) ([]model.Policy, error)
 	PatchFeed(ctx context.Context, id string, feedtype model.FeedType, position int) error
+	SetPositionRange(ctx context.Context, id string, maxPosition *int, minSpacing int, anchor model.Anchor) error
+	SetPinColdstart(ctx context.Context, id string, coldstart bool) error
+	SetPolicies(ctx context.Context, id string, policies pq.StringArray) error
+	AddPolicy(ctx context.Context, id, policy string) error
+	RemovePolicy(ctx context.Context, id, policy string) error
 	DeleteFeed(ctx context.Context, id string) error
 	AddRelation(ctx context.Context, feedID, relatedFeedID string) error
 	RemoveRelation(ctx context.Context, feedID, relatedFeedID string) error
 	GetRelatedFeeds(ctx context.Context, feedID string) ([]string, error)
+	GetRelations(ctx context.Context) ([]model.Relation, error)
+	GetGroups(ctx context.Context) ([]model.Group, error)
+	GetGroup(ctx context.Context, holderID string) (*model.Group, error)
+	GetGroupsByMember(ctx context.Context, feedID string) ([]model.Group, error)
+	SetRelationPriority(ctx context.Context, feedID, relatedFeedID string, priority int) error
+	SetRelationWeight(ctx context.Context, feedID, relatedFeedID string, weight float64) error
+	SetRelationPolicies(ctx context.Context, feedID, relatedFeedID string, policies pq.StringArray) error
+	AddRelationPolicy(ctx context.Context, feedID, relatedFeedID, policy string) error
+	RemoveRelationPolicy(ctx context.Context, feedID, relatedFeedID, policy string) error
 	CreateFeedPosition(ctx context.Context, feedID string, feedType model.FeedType, position int, policies pq.StringArray) error
+	AddGroupMember(ctx context.Context, feedID, holderID string, policies pq.StringArray) error
 	DeleteFeedPosition(ctx context.Context, feedID string, position int) error
+	GetBoosts(ctx context.Context) ([]model.Boost, error)
+	SetBoost(ctx context.Context, boost model.Boost) error
+	DeleteBoost(ctx context.Context, feedID string, feedType model.FeedType) error
+	RepairRelationPolicies(ctx context.Context, dryRun bool) ([]model.InvalidPolicy, error)
 }
 
+// GetFeeds builds a feed for every item of data and runs them through the
+// pipeline (see SetPipeline): by default sorted by score, then with pinned
+// and coldstart feeds inserted.
 func (f *Service[T]) GetFeeds(ctx context.Context, data []T) (model.Feeds[T], error) {
-	coldstart, _ := ctx.Value(model.COLD_START_KEY).(bool)
-	position, _ := ctx.Value(model.POSITION_KEY).(string)
-
 	feeds := model.Feeds[T]{}
 	for i := range data {
 		feeds = append(
@@ -52,121 +129,46 @@ func (f *Service[T]) GetFeeds(ctx context.Context, data []T) (model.Feeds[T], er
 		)
 	}
 
-	// sort with scores
-	feeds.Sort()
-
-	var positions []model.Policy
-	var err error
-
-	if coldstart {
-		logging.Infow(ctx, "coldstart feed retrieval", "position", position)
-
-		// Prefer the caller-supplied coldstart id set (already merged across
-		// audiences and filtered for watched feeds); fall back to the default
-		// feed_coldstart table for callers that don't supply one.
-		var idList []string
-		if ids, ok := ctx.Value(model.COLD_START_IDS_KEY).([]string); ok && len(ids) > 0 {
-			idList = ids
-		} else {
-			positions, err = f.store.GetColdstart(ctx)
-			if err != nil {
-				return nil, err
-			}
-			for _, p := range positions {
-				idList = append(idList, p.FeedId)
-			}
-		}
-
-		// Select at most 5 coldstart feed IDs
-		if len(idList) > 5 {
-			rand.Shuffle(len(idList), func(i, j int) {
-				idList[i], idList[j] = idList[j], idList[i]
-			})
-			idList = idList[:5]
-		}
-
-		// Build set of coldstart feed IDs
-		coldstartIDs := make(map[string]bool)
-		for _, id := range idList {
-			coldstartIDs[id] = true
-		}
-
-		// Remove coldstart feeds from list
-		var coldstartFeeds []model.Feed[T]
-		feeds = slices.DeleteFunc(feeds, func(feed model.Feed[T]) bool {
-			if coldstartIDs[feed.ID] {
-				coldstartFeeds = append(coldstartFeeds, feed)
-				return true
-			}
-			return false
-		})
-
-		// Insert at random positions in first 10
-		randomPositions := rand.Perm(10)[:len(coldstartFeeds)]
-		sort.Ints(randomPositions)
-		for i, pos := range randomPositions {
-			feeds = slices.Insert(feeds, pos, coldstartFeeds[i])
-		}
-	} else {
-		positions, err = f.store.GetPolicies(ctx)
-		if err != nil {
-			return nil, err
-		}
-
-		// create a position map to speed up the discovery of positioned feeds.
-		positionMap := make(map[string]int)
-		for _, position := range positions {
-			positionMap[position.FeedId] = position.Position
-		}
-
-		// create a position->feed map
-		positionedFeedMap := make(map[int]model.Feed[T])
-
-		nonPositionedFeeds := feeds[:0]
-		for i := 0; i < len(feeds); i++ {
-			if v, exists := positionMap[feeds[i].ID]; exists {
-				// if the feed is positioned, put it into map
-				positionedFeedMap[v] = feeds[i]
-			} else {
-				// collect it otherwise
-				nonPositionedFeeds = append(nonPositionedFeeds, feeds[i])
-			}
-		}
-		feeds = nonPositionedFeeds
-
-		for _, p := range positions {
-			if feed, exist := positionedFeedMap[p.Position]; exist {
-				if len(feeds) < p.Position {
-					feeds = append(feeds, feed)
-				} else {
-					feeds = slices.Insert(feeds, p.Position, feed)
-				}
-			}
-		}
-	}
-
-	return feeds, nil
+	return f.rerank(ctx, feeds)
 }
 
+// GetPolicies lists the first maxPositions slots counted from the start of the
+// feed, each with the pins starting there (range pins carry MaxPosition) or
+// an empty policy when there are none. End-anchored pins count from the end
+// of the first page instead, so they follow the slots rather than take one,
+// those among the last maxPositions in position order.
 func (f *Service[T]) GetPolicies(ctx context.Context, maxPositions int) ([]model.Policy, error) {
-	usedPositions, err := f.store.GetPolicies(ctx)
+	pins, err := f.store.GetPolicies(ctx)
 	if err != nil {
 		return nil, err
 	}
+	var usedPositions, endPositions []model.Policy
+	for _, p := range pins {
+		if p.Anchor == model.AnchorEnd {
+			if p.Position < maxPositions {
+				endPositions = append(endPositions, p)
+			}
+			continue
+		}
+		usedPositions = append(usedPositions, p)
+	}
 	positions := []model.Policy{}
 	for i, j := 0, 0; i < maxPositions; i++ {
-		if j < len(usedPositions) {
-			if usedPositions[j].Position == i {
-				positions = append(positions, usedPositions[j])
-				j++
-				continue
-			}
+		// range pins may share a position with each other
+		used := false
+		for j < len(usedPositions) && usedPositions[j].Position == i {
+			positions = append(positions, usedPositions[j])
+			used = true
+			j++
+		}
+		if used {
+			continue
 		}
 		positions = append(positions, model.Policy{
 			Position: i,
 		})
 	}
-	return positions, nil
+	return append(positions, endPositions...), nil
 }
 
 // GetColdstartBySpecialty returns the specialty coldstart policies matching the
@@ -186,20 +188,70 @@ func (f *Service[T]) GetColdstartByAudience(ctx context.Context, audience string
 	return f.store.GetColdstartByAudience(ctx, audience)
 }
 
+// PatchFeed pins a feed at position, moving it when already pinned. Moving a
+// range pin past its max position returns store.ErrInvalidPositionRange.
 func (s *Service[T]) PatchFeed(ctx context.Context, id string, feedtype model.FeedType, position int) error {
-	return s.store.PatchFeed(ctx, id, feedtype, position)
+	return s.invalidated(ctx, s.store.PatchFeed(ctx, id, feedtype, position))
+}
+
+// SetPositionRange lets a pinned feed land anywhere from its position to
+// maxPosition, at least minSpacing unpinned feeds away from other pins, with
+// positions counted from anchor. A nil maxPosition makes it an exact pin
+// again. Returns sql.ErrNoRows when the feed is not pinned and
+// store.ErrInvalidPositionRange when maxPosition is before its position or
+// minSpacing is negative.
+func (s *Service[T]) SetPositionRange(ctx context.Context, id string, maxPosition *int, minSpacing int, anchor model.Anchor) error {
+	return s.invalidated(ctx, s.store.SetPositionRange(ctx, id, maxPosition, minSpacing, anchor))
+}
+
+// SetPinColdstart sets whether a pinned feed is also pinned in coldstart
+// feeds, where its position is reserved before the coldstart feeds are
+// inserted. Returns sql.ErrNoRows when the feed is not pinned.
+func (s *Service[T]) SetPinColdstart(ctx context.Context, id string, coldstart bool) error {
+	return s.invalidated(ctx, s.store.SetPinColdstart(ctx, id, coldstart))
+}
+
+// SetPolicies replaces the policies of a pinned feed. Every policy is validated
+// first. Returns sql.ErrNoRows when the feed is not pinned.
+func (s *Service[T]) SetPolicies(ctx context.Context, id string, policies pq.StringArray) error {
+	return s.invalidated(ctx, s.store.SetPolicies(ctx, id, policies))
+}
+
+// AddPolicy adds a validated policy to a pinned feed unless it already has it.
+func (s *Service[T]) AddPolicy(ctx context.Context, id, policy string) error {
+	return s.invalidated(ctx, s.store.AddPolicy(ctx, id, policy))
+}
+
+// RemovePolicy removes a policy from a pinned feed.
+func (s *Service[T]) RemovePolicy(ctx context.Context, id, policy string) error {
+	return s.invalidated(ctx, s.store.RemovePolicy(ctx, id, policy))
 }
 
 func (s *Service[T]) DeleteFeed(ctx context.Context, id string) error {
-	return s.store.DeleteFeed(ctx, id)
+	return s.invalidated(ctx, s.store.DeleteFeed(ctx, id))
 }
 
+// CreateFeedPosition pins feedID at position, counted from the start. When an
+// exact start-anchored post already holds it, feedID joins its posts group
+// instead. Use AddGroupMember to join the group of a range or end-anchored
+// slot.
 func (s *Service[T]) CreateFeedPosition(ctx context.Context, feedID string, feedType model.FeedType, position int, policies pq.StringArray) error {
-	return s.store.CreateFeedPosition(ctx, feedID, feedType, position, policies)
+	return s.invalidated(ctx, s.store.CreateFeedPosition(ctx, feedID, feedType, position, policies))
 }
 
+// AddGroupMember queues feedID behind the pinned post holderID, whatever the
+// anchor or range of its slot, making it a posts group. Returns sql.ErrNoRows
+// when holderID is not pinned.
+func (s *Service[T]) AddGroupMember(ctx context.Context, feedID, holderID string, policies pq.StringArray) error {
+	return s.invalidated(ctx, s.store.AddGroupMember(ctx, feedID, holderID, policies))
+}
+
+// DeleteFeedPosition unpins feedID from position, promoting the next member
+// into its slot when it holds a posts group. When feedID is not pinned there,
+// it leaves the group at position it is a member of. Either way, slots of any
+// anchor or range are found by their Position.
 func (s *Service[T]) DeleteFeedPosition(ctx context.Context, feedID string, position int) error {
-	return s.store.DeleteFeedPosition(ctx, feedID, position)
+	return s.invalidated(ctx, s.store.DeleteFeedPosition(ctx, feedID, position))
 }
 
 func (f *Service[T]) BuildPolicyViolationMap(ctx context.Context, userID string, policyMap map[string]*model.Policy, resolver model.PolicyResolver) map[string]string {
@@ -238,6 +290,103 @@ func (f *Service[T]) BuildPolicyViolationMap(ctx context.Context, userID string,
 	return violation
 }
 
+// ExplainPolicies is a dry run of every policy on a feed for one user: each
+// policy is evaluated without short-circuiting, with the resolver values it was
+// judged on, any parse or resolver error, and the final verdict. Meant for
+// answering "why isn't this feed showing for user X". Policies are evaluated
+// with the resolver of WithPolicyResolver, as in GetFeeds. A feed that is
+// neither pinned nor queued in a relation has no policies and is never hidden.
+func (f *Service[T]) ExplainPolicies(ctx context.Context, userID, feedID string) (*model.PolicyExplanation, error) {
+	policy, err := f.store.GetPolicy(ctx, feedID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	var policies []string
+	if policy != nil {
+		policies = policy.Policies
+	}
+	explanation := model.ExplainPolicies(ctx, userID, feedID, policies, f.resolver)
+	explanation.Policy = policy
+	return &explanation, nil
+}
+
+// RepairRelationPolicies reports relation policies that fail validation and,
+// unless dryRun is set, strips them (see store.RepairRelationPolicies). Only a
+// process that registered exactly the policy kinds the trigger accepts can
+// strip them; others get store.ErrPolicyKindsMismatch.
+func (s *Service[T]) RepairRelationPolicies(ctx context.Context, dryRun bool) ([]model.InvalidPolicy, error) {
+	invalid, err := s.store.RepairRelationPolicies(ctx, dryRun)
+	if !dryRun && len(invalid) > 0 {
+		err = s.invalidated(ctx, err)
+	}
+	return invalid, err
+}
+
 func (s *Service[T]) GetRelatedFeeds(ctx context.Context, feedID string) ([]string, error) {
 	return s.store.GetRelatedFeeds(ctx, feedID)
 }
+
+// GetGroups returns the whole layout: every pinned slot, by position, with the
+// members queued behind it.
+func (s *Service[T]) GetGroups(ctx context.Context) ([]model.Group, error) {
+	return s.store.GetGroups(ctx)
+}
+
+// GetGroup returns the slot held by holderID with its members. Returns
+// sql.ErrNoRows when holderID is not pinned.
+func (s *Service[T]) GetGroup(ctx context.Context, holderID string) (*model.Group, error) {
+	return s.store.GetGroup(ctx, holderID)
+}
+
+// GetGroupsByMember returns the slots feedID is queued under.
+func (s *Service[T]) GetGroupsByMember(ctx context.Context, feedID string) ([]model.Group, error) {
+	return s.store.GetGroupsByMember(ctx, feedID)
+}
+
+// SetRelationPriority sets the priority of feedID within the posts group held
+// by relatedFeedID. Higher priorities are promoted first.
+func (s *Service[T]) SetRelationPriority(ctx context.Context, feedID, relatedFeedID string, priority int) error {
+	return s.invalidated(ctx, s.store.SetRelationPriority(ctx, feedID, relatedFeedID, priority))
+}
+
+// SetRelationWeight sets the weight of feedID within the posts group held by
+// relatedFeedID. Weight breaks promotion ties and is the member's share under
+// model.RotationWeightedRandom.
+func (s *Service[T]) SetRelationWeight(ctx context.Context, feedID, relatedFeedID string, weight float64) error {
+	return s.invalidated(ctx, s.store.SetRelationWeight(ctx, feedID, relatedFeedID, weight))
+}
+
+// SetRelationPolicies replaces the policies of feedID within the posts group
+// held by relatedFeedID. Every policy is validated first. Returns
+// sql.ErrNoRows when there is no such relation.
+func (s *Service[T]) SetRelationPolicies(ctx context.Context, feedID, relatedFeedID string, policies pq.StringArray) error {
+	return s.invalidated(ctx, s.store.SetRelationPolicies(ctx, feedID, relatedFeedID, policies))
+}
+
+// AddRelationPolicy adds a validated policy to feedID within the posts group
+// held by relatedFeedID unless it already has it.
+func (s *Service[T]) AddRelationPolicy(ctx context.Context, feedID, relatedFeedID, policy string) error {
+	return s.invalidated(ctx, s.store.AddRelationPolicy(ctx, feedID, relatedFeedID, policy))
+}
+
+// RemoveRelationPolicy removes a policy from feedID within the posts group
+// held by relatedFeedID.
+func (s *Service[T]) RemoveRelationPolicy(ctx context.Context, feedID, relatedFeedID, policy string) error {
+	return s.invalidated(ctx, s.store.RemoveRelationPolicy(ctx, feedID, relatedFeedID, policy))
+}
+
+// GetBoosts returns every stored boost, expired ones included.
+func (s *Service[T]) GetBoosts(ctx context.Context) ([]model.Boost, error) {
+	return s.store.GetBoosts(ctx)
+}
+
+// SetBoost creates or replaces the boost of a feed or a feed type.
+func (s *Service[T]) SetBoost(ctx context.Context, boost model.Boost) error {
+	return s.invalidated(ctx, s.store.SetBoost(ctx, boost))
+}
+
+// DeleteBoost deletes the boost of feedID, or of feedType when feedID is
+// empty. Returns sql.ErrNoRows when there is none.
+func (s *Service[T]) DeleteBoost(ctx context.Context, feedID string, feedType model.FeedType) error {
+	return s.invalidated(ctx, s.store.DeleteBoost(ctx, feedID, feedType))
+}
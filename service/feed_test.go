@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"os"
@@ -53,15 +54,41 @@ type mockStore struct {
 	addErr        error
 	removeErr     error
 	getRelatedErr error
+
+	invalidPolicies []model.InvalidPolicy
+	relations       []model.Relation
+	relationsErr    error
+	setRelationErr  error
+	groups          []model.Group
+	setPoliciesErr  error
+	boosts          []model.Boost
+	boostsErr       error
+
+	policiesCalls  int
+	relationsCalls int
+	boostsCalls    int
 }
 
 func (m *mockStore) GetPolicies(ctx context.Context) ([]model.Policy, error) {
+	m.policiesCalls++
 	if m.policiesErr != nil {
 		return nil, m.policiesErr
 	}
 	return m.policies, nil
 }
 
+func (m *mockStore) GetPolicy(ctx context.Context, feedID string) (*model.Policy, error) {
+	if m.policiesErr != nil {
+		return nil, m.policiesErr
+	}
+	for i := range m.policies {
+		if m.policies[i].FeedId == feedID {
+			return &m.policies[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
 func (m *mockStore) GetColdstart(ctx context.Context) ([]model.Policy, error) {
 	if m.policiesErr != nil {
 		return nil, m.policiesErr
@@ -83,10 +110,63 @@ func (m *mockStore) GetColdstartBySpecialty(ctx context.Context, specialties []s
 	return m.policies, nil
 }
 
+func (m *mockStore) GetBoosts(ctx context.Context) ([]model.Boost, error) {
+	m.boostsCalls++
+	return m.boosts, m.boostsErr
+}
+
+func (m *mockStore) SetBoost(ctx context.Context, boost model.Boost) error {
+	if m.boostsErr != nil {
+		return m.boostsErr
+	}
+	m.boosts = append(m.boosts, boost)
+	return nil
+}
+
+func (m *mockStore) DeleteBoost(ctx context.Context, feedID string, feedType model.FeedType) error {
+	return m.boostsErr
+}
+
 func (m *mockStore) PatchFeed(ctx context.Context, id string, feedtype model.FeedType, position int) error {
 	return m.patchErr
 }
 
+func (m *mockStore) SetPositionRange(ctx context.Context, id string, maxPosition *int, minSpacing int, anchor model.Anchor) error {
+	return m.patchErr
+}
+
+func (m *mockStore) AddGroupMember(ctx context.Context, feedID, holderID string, policies pq.StringArray) error {
+	return m.setRelationErr
+}
+
+func (m *mockStore) SetPinColdstart(ctx context.Context, id string, coldstart bool) error {
+	return m.patchErr
+}
+
+func (m *mockStore) SetPolicies(ctx context.Context, id string, policies pq.StringArray) error {
+	return m.setPoliciesErr
+}
+
+func (m *mockStore) AddPolicy(ctx context.Context, id, policy string) error {
+	return m.setPoliciesErr
+}
+
+func (m *mockStore) RemovePolicy(ctx context.Context, id, policy string) error {
+	return m.setPoliciesErr
+}
+
+func (m *mockStore) SetRelationPolicies(ctx context.Context, feedID, relatedFeedID string, policies pq.StringArray) error {
+	return m.setPoliciesErr
+}
+
+func (m *mockStore) AddRelationPolicy(ctx context.Context, feedID, relatedFeedID, policy string) error {
+	return m.setPoliciesErr
+}
+
+func (m *mockStore) RemoveRelationPolicy(ctx context.Context, feedID, relatedFeedID, policy string) error {
+	return m.setPoliciesErr
+}
+
 func (m *mockStore) DeleteFeed(ctx context.Context, id string) error {
 	return m.deleteErr
 }
@@ -112,6 +192,57 @@ func (m *mockStore) GetRelatedFeeds(ctx context.Context, feedID string) ([]strin
 	return []string{}, nil
 }
 
+func (m *mockStore) GetRelations(ctx context.Context) ([]model.Relation, error) {
+	m.relationsCalls++
+	if m.relationsErr != nil {
+		return nil, m.relationsErr
+	}
+	return m.relations, nil
+}
+
+func (m *mockStore) GetGroups(ctx context.Context) ([]model.Group, error) {
+	if m.relationsErr != nil {
+		return nil, m.relationsErr
+	}
+	return m.groups, nil
+}
+
+func (m *mockStore) GetGroup(ctx context.Context, holderID string) (*model.Group, error) {
+	if m.relationsErr != nil {
+		return nil, m.relationsErr
+	}
+	for i := range m.groups {
+		if m.groups[i].Holder.FeedId == holderID {
+			return &m.groups[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockStore) GetGroupsByMember(ctx context.Context, feedID string) ([]model.Group, error) {
+	if m.relationsErr != nil {
+		return nil, m.relationsErr
+	}
+	groups := []model.Group{}
+	for _, group := range m.groups {
+		for _, member := range group.Members {
+			if member.FeedId == feedID {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+	return groups, nil
+}
+
+func (m *mockStore) SetRelationPriority(ctx context.Context, feedID, relatedFeedID string, priority int) error {
+	return m.setRelationErr
+}
+
+func (m *mockStore) SetRelationWeight(ctx context.Context, feedID, relatedFeedID string, weight float64) error {
+	return m.setRelationErr
+}
+
 func (m *mockStore) CreateFeedPosition(ctx context.Context, feedID string, feedType model.FeedType, position int, policies pq.StringArray) error {
 	return nil
 }
@@ -120,6 +251,13 @@ func (m *mockStore) DeleteFeedPosition(ctx context.Context, feedID string, posit
 	return nil
 }
 
+func (m *mockStore) RepairRelationPolicies(ctx context.Context, dryRun bool) ([]model.InvalidPolicy, error) {
+	if m.policiesErr != nil {
+		return nil, m.policiesErr
+	}
+	return m.invalidPolicies, nil
+}
+
 // Mock policy resolver
 type mockPolicyResolver struct {
 	viewCounts       map[string]int64
@@ -413,6 +551,39 @@ func TestGetPolicies(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:         "range pins sharing a position",
+			maxPositions: 3,
+			usedPolicies: []model.Policy{
+				{FeedId: "feed1", FeedType: model.TypePost, Position: 1, MaxPosition: intPtr(4)},
+				{FeedId: "feed2", FeedType: model.TypePost, Position: 1, MaxPosition: intPtr(2)},
+			},
+			expectedCount: 4,
+			validateResult: func(t *testing.T, policies []model.Policy) {
+				if policies[1].FeedId != "feed1" || policies[2].FeedId != "feed2" || policies[3].Position != 2 || policies[3].FeedId != "" {
+					t.Errorf("unexpected policies %+v", policies)
+				}
+			},
+		},
+		{
+			name:         "end-anchored pins follow the slots",
+			maxPositions: 3,
+			usedPolicies: []model.Policy{
+				{FeedId: "end0", FeedType: model.TypePost, Position: 0, Anchor: model.AnchorEnd},
+				{FeedId: "start0", FeedType: model.TypePost, Position: 0, Anchor: model.AnchorStart},
+				{FeedId: "end1", FeedType: model.TypePost, Position: 1, Anchor: model.AnchorEnd},
+				{FeedId: "end5", FeedType: model.TypePost, Position: 5, Anchor: model.AnchorEnd},
+			},
+			expectedCount: 5,
+			validateResult: func(t *testing.T, policies []model.Policy) {
+				if policies[0].FeedId != "start0" || policies[1].FeedId != "" || policies[2].FeedId != "" {
+					t.Errorf("unexpected slots %+v", policies[:3])
+				}
+				if policies[3].FeedId != "end0" || policies[4].FeedId != "end1" || policies[4].Anchor != model.AnchorEnd {
+					t.Errorf("unexpected end pins %+v", policies[3:])
+				}
+			},
+		},
 		{
 			name:         "mix used and empty positions",
 			maxPositions: 5,
@@ -552,6 +723,27 @@ func TestPatchFeed(t *testing.T) {
 	}
 }
 
+func TestUpdatePolicies(t *testing.T) {
+	ctx := context.Background()
+
+	for _, storeErr := range []error{nil, sql.ErrNoRows} {
+		svc := NewFeed[MockPost](&mockStore{setPoliciesErr: storeErr})
+		calls := map[string]error{
+			"SetPolicies":          svc.SetPolicies(ctx, "feed123", pq.StringArray{"exposure:1000"}),
+			"AddPolicy":            svc.AddPolicy(ctx, "feed123", "exposure:1000"),
+			"RemovePolicy":         svc.RemovePolicy(ctx, "feed123", "exposure:1000"),
+			"SetRelationPolicies":  svc.SetRelationPolicies(ctx, "feed456", "feed123", pq.StringArray{"exposure:1000"}),
+			"AddRelationPolicy":    svc.AddRelationPolicy(ctx, "feed456", "feed123", "exposure:1000"),
+			"RemoveRelationPolicy": svc.RemoveRelationPolicy(ctx, "feed456", "feed123", "exposure:1000"),
+		}
+		for name, err := range calls {
+			if !errors.Is(err, storeErr) {
+				t.Errorf("%s: expected %v, got %v", name, storeErr, err)
+			}
+		}
+	}
+}
+
 func TestDeleteFeed(t *testing.T) {
 	ctx := context.Background()
 
@@ -1520,3 +1712,218 @@ func TestGetRelatedFeeds(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildPolicyViolationMap_Preview(t *testing.T) {
+	// The same policy map evaluated at two moments, without sleeping: the
+	// window opens at 1735689600 (2025-01-01) and closes a day later.
+	policyMap := map[string]*model.Policy{
+		"post1": {
+			FeedId:   "post1",
+			Policies: pq.StringArray{"inexpose:1735689600", "unexpose:1735776000"},
+		},
+	}
+
+	tests := []struct {
+		name               string
+		now                time.Time
+		expectedViolations map[string]string
+	}{
+		{
+			name:               "before the window",
+			now:                time.Unix(1735689599, 0),
+			expectedViolations: map[string]string{"post1": "inexpose:1735689600"},
+		},
+		{
+			name:               "inside the window",
+			now:                time.Unix(1735732800, 0),
+			expectedViolations: map[string]string{},
+		},
+		{
+			name:               "after the window",
+			now:                time.Unix(1735776001, 0),
+			expectedViolations: map[string]string{"post1": "unexpose:1735776000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewFeed[MockPost](&mockStore{})
+			ctx := context.WithValue(context.Background(), model.NOW_KEY, tt.now)
+
+			violations := svc.BuildPolicyViolationMap(ctx, "test-user", policyMap, &mockPolicyResolver{})
+
+			if len(violations) != len(tt.expectedViolations) {
+				t.Fatalf("expected %d violations, got %d: %v", len(tt.expectedViolations), len(violations), violations)
+			}
+			for feedID, expectedPolicy := range tt.expectedViolations {
+				if violations[feedID] != expectedPolicy {
+					t.Errorf("for feed %s: expected policy %s, got %s", feedID, expectedPolicy, violations[feedID])
+				}
+			}
+		})
+	}
+}
+
+func TestExplainPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("explains a pinned feed", func(t *testing.T) {
+		resolver := &mockPolicyResolver{
+			viewCounts: map[string]int64{"post1": 1500},
+			userAttrs:  map[string][]string{"user1": {"premium"}},
+		}
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{
+				{FeedId: "post1", FeedType: model.TypePost, Position: 2, Policies: pq.StringArray{"istarget:premium", "exposure:1000"}},
+			},
+		}, WithPolicyResolver(resolver))
+
+		explanation, err := svc.ExplainPolicies(ctx, "user1", "post1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if explanation.Policy == nil || explanation.Policy.Position != 2 {
+			t.Errorf("expected the pin to be reported, got %+v", explanation.Policy)
+		}
+		if len(explanation.Results) != 2 {
+			t.Fatalf("expected 2 results, got %d", len(explanation.Results))
+		}
+		if !explanation.Violated || explanation.ViolatedPolicy != "exposure:1000" {
+			t.Errorf("expected exposure:1000 to hide the feed, got %+v", explanation)
+		}
+		if explanation.Results[1].Values["views"] != int64(1500) {
+			t.Errorf("expected the view count to be reported, got %v", explanation.Results[1].Values)
+		}
+	})
+
+	t.Run("feed without policies is visible", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{}, WithPolicyResolver(&mockPolicyResolver{}))
+
+		explanation, err := svc.ExplainPolicies(ctx, "user1", "post1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if explanation.Policy != nil || explanation.Violated || len(explanation.Results) != 0 {
+			t.Errorf("expected an empty explanation, got %+v", explanation)
+		}
+	})
+
+	t.Run("without a resolver policies do not take effect", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{
+				{FeedId: "post1", FeedType: model.TypePost, Position: 2, Policies: pq.StringArray{"exposure:1000"}},
+			},
+		})
+
+		explanation, err := svc.ExplainPolicies(ctx, "user1", "post1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if explanation.Violated {
+			t.Errorf("expected the feed to stay visible like in GetFeeds, got %+v", explanation)
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{policiesErr: errors.New("database error")}, WithPolicyResolver(&mockPolicyResolver{}))
+
+		if _, err := svc.ExplainPolicies(ctx, "user1", "post1"); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+}
+
+func TestGetFeeds_Diversity(t *testing.T) {
+	ctx := context.Background()
+	data := []MockPost{
+		{id: "chat1", feedType: model.TypeChat, score: 90},
+		{id: "chat2", feedType: model.TypeChat, score: 80},
+		{id: "chat3", feedType: model.TypeChat, score: 70},
+		{id: "post1", feedType: model.TypePost, score: 60},
+		{id: "post2", feedType: model.TypePost, score: 50},
+		{id: "pinned", feedType: model.TypeChat, score: 1},
+	}
+	diversity := model.Diversity{MaxConsecutive: 1}
+
+	t.Run("scored feeds are interleaved before pins", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{{FeedId: "pinned", FeedType: model.TypeChat, Position: 1}},
+		}, WithDiversity(diversity))
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []string{"chat1", "pinned", "post1", "chat2", "post2", "chat3"}
+		if got := pageIDs(feeds); !equalIDs(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("coldstart feeds are not subject to the rules", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{}, WithDiversity(diversity))
+		ctx := context.WithValue(ctx, model.COLD_START_KEY, true)
+		ctx = context.WithValue(ctx, model.COLD_START_IDS_KEY, []string{"chat3"})
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var rest []string
+		for _, feed := range feeds {
+			if feed.ID != "chat3" {
+				rest = append(rest, feed.ID)
+			}
+		}
+		expected := []string{"chat1", "post1", "chat2", "post2", "pinned"}
+		if !equalIDs(rest, expected) {
+			t.Errorf("expected %v around the coldstart feed, got %v", expected, rest)
+		}
+	})
+
+	t.Run("diversity is a stage of its own", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{{FeedId: "pinned", FeedType: model.TypeChat, Position: 1}},
+		}, WithDiversity(diversity))
+		svc.SetPipeline(svc.SortStage(), svc.DiversityStage())
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// the pinned feed keeps its index, for a pin stage to take it out
+		expected := []string{"chat1", "post1", "chat2", "post2", "chat3", "pinned"}
+		if got := pageIDs(feeds); !equalIDs(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("coldstart feeds keep their index", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{}, WithDiversity(diversity))
+		svc.SetPipeline(svc.SortStage(), svc.DiversityStage())
+		ctx := context.WithValue(ctx, model.COLD_START_KEY, true)
+		ctx = context.WithValue(ctx, model.COLD_START_IDS_KEY, []string{"chat1"})
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []string{"chat1", "chat2", "post1", "chat3", "post2", "pinned"}
+		if got := pageIDs(feeds); !equalIDs(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("no rules keep the score order", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{})
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []string{"chat1", "chat2", "chat3", "post1", "post2", "pinned"}
+		if got := pageIDs(feeds); !equalIDs(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+// ErrInvalidCursor is returned by GetFeedsPage for a cursor it did not issue.
+var ErrInvalidCursor = errors.New("invalid feed cursor")
+
+const cursorVersion = 1
+
+// cursor is the ranking snapshot carried between pages: either the ids still
+// to be served, in the order the first page assembled them, or, with a page
+// cache, the key of the cached list and how much of it was served.
+type cursor struct {
+	Version int      `json:"v"`
+	IDs     []string `json:"ids,omitempty"`
+	Key     string   `json:"k,omitempty"`
+	Offset  int      `json:"o,omitempty"`
+}
+
+// encodeCursor deflates the JSON of c, so that a cursor carrying ids stays a
+// fraction of their length.
+func encodeCursor(c cursor) (string, error) {
+	c.Version = cursorVersion
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	b, err = io.ReadAll(flate.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		return c, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if c.Version != cursorVersion {
+		return c, fmt.Errorf("%w: unsupported version %d", ErrInvalidCursor, c.Version)
+	}
+	if c.Offset < 0 || (c.Key == "" && len(c.IDs) == 0) {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// pageCacheKey scopes cached lists to the user they were assembled for, so a
+// cursor is useless to anyone else.
+func pageCacheKey(ctx context.Context, token string) string {
+	userID, _ := ctx.Value(model.USER_ID_KEY).(string)
+	return userID + "/" + token
+}
+
+func newPageToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetFeedsPage returns the feeds one page at a time. The first call, with an
+// empty cursor, assembles the whole list like GetFeeds, with limit as the
+// page size end-anchored pins count from unless PAGE_SIZE_KEY is set. The
+// returned cursor snapshots the order of everything not served yet, so later
+// pages continue that same list: pins and coldstart insertions do not move
+// and no feed is served twice, however scores change in between.
+//
+// Without a page cache, later calls take the same data again to look the
+// feeds up; a feed of the snapshot missing from data (e.g. now hidden by a
+// policy) is skipped, and data that was not in the snapshot is not served.
+// The cursor is compressed but still grows with the number of feeds left;
+// use a page cache to keep cursors short for long feeds.
+//
+// With a page cache (see WithPageCache), the assembled list is kept in the
+// cache under the user in USER_ID_KEY and later pages are served from it:
+// data is ignored and may be nil. Once the entry is evicted or invalidated,
+// the cursor fails with ErrInvalidCursor.
+//
+// The cursor is empty once the list is exhausted.
+func (f *Service[T]) GetFeedsPage(ctx context.Context, data []T, cursor string, limit int) (model.Feeds[T], string, error) {
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("invalid page limit %d", limit)
+	}
+
+	if cursor == "" {
+		if _, ok := ctx.Value(model.PAGE_SIZE_KEY).(int); !ok {
+			ctx = context.WithValue(ctx, model.PAGE_SIZE_KEY, limit)
+		}
+		feeds, err := f.GetFeeds(ctx, data)
+		if err != nil {
+			return nil, "", err
+		}
+		if f.pageCache == nil || len(feeds) <= limit {
+			return paginate(feeds, limit)
+		}
+		token, err := newPageToken()
+		if err != nil {
+			return nil, "", err
+		}
+		f.pageCache.Set(ctx, pageCacheKey(ctx, token), feeds)
+		return paginateCached(feeds, token, 0, limit)
+	}
+
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if c.Key != "" {
+		if f.pageCache == nil {
+			return nil, "", fmt.Errorf("%w: no page cache", ErrInvalidCursor)
+		}
+		cached, ok := f.pageCache.Get(ctx, pageCacheKey(ctx, c.Key))
+		if !ok {
+			return nil, "", fmt.Errorf("%w: expired", ErrInvalidCursor)
+		}
+		feeds, ok := cached.(model.Feeds[T])
+		if !ok || c.Offset > len(feeds) {
+			return nil, "", ErrInvalidCursor
+		}
+		return paginateCached(feeds, c.Key, c.Offset, limit)
+	}
+
+	byID := make(map[string]T, len(data))
+	for _, d := range data {
+		byID[d.GetID()] = d
+	}
+	feeds := make(model.Feeds[T], 0, len(c.IDs))
+	for _, id := range c.IDs {
+		if d, ok := byID[id]; ok {
+			feeds = append(feeds, model.Feed[T]{
+				ID:   d.GetID(),
+				Type: d.Feedtype(),
+				Data: d,
+			})
+		}
+	}
+	return paginate(feeds, limit)
+}
+
+// paginate returns the first page of feeds and a cursor carrying the ids of
+// the rest.
+func paginate[T model.Scorable](feeds model.Feeds[T], limit int) (model.Feeds[T], string, error) {
+	if len(feeds) <= limit {
+		return feeds, "", nil
+	}
+	rest := make([]string, 0, len(feeds)-limit)
+	for _, feed := range feeds[limit:] {
+		rest = append(rest, feed.ID)
+	}
+	next, err := encodeCursor(cursor{IDs: rest})
+	if err != nil {
+		return nil, "", err
+	}
+	return feeds[:limit], next, nil
+}
+
+// paginateCached returns the page of the cached feeds starting at offset and
+// a cursor to the next one. The page is capped so that appending to it does
+// not overwrite the cached feeds after it.
+func paginateCached[T model.Scorable](feeds model.Feeds[T], token string, offset, limit int) (model.Feeds[T], string, error) {
+	end := min(offset+limit, len(feeds))
+	if end == len(feeds) {
+		return feeds[offset:end:end], "", nil
+	}
+	next, err := encodeCursor(cursor{Key: token, Offset: end})
+	if err != nil {
+		return nil, "", err
+	}
+	return feeds[offset:end:end], next, nil
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+func pageIDs(feeds model.Feeds[MockPost]) []string {
+	ids := make([]string, len(feeds))
+	for i, feed := range feeds {
+		ids[i] = feed.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetFeedsPage(t *testing.T) {
+	ctx := context.Background()
+	data := []MockPost{
+		{id: "post1", feedType: model.TypePost, score: 90},
+		{id: "post2", feedType: model.TypePost, score: 80},
+		{id: "post3", feedType: model.TypePost, score: 70},
+		{id: "post4", feedType: model.TypePost, score: 60},
+		{id: "post5", feedType: model.TypePost, score: 50},
+		{id: "pinned", feedType: model.TypePost, score: 1},
+	}
+
+	t.Run("pages follow the first assembly", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{{FeedId: "pinned", FeedType: model.TypePost, Position: 3}},
+		})
+
+		page, cursor, err := svc.GetFeedsPage(ctx, data, "", 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(page); !equalIDs(got, []string{"post1", "post2"}) {
+			t.Fatalf("unexpected first page %v", got)
+		}
+
+		// scores change between requests; the snapshot keeps the order
+		rescored := append([]MockPost{}, data...)
+		rescored[4].score = 1000
+
+		page, cursor, err = svc.GetFeedsPage(ctx, rescored, cursor, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(page); !equalIDs(got, []string{"post3", "pinned"}) {
+			t.Fatalf("unexpected second page %v", got)
+		}
+
+		page, cursor, err = svc.GetFeedsPage(ctx, rescored, cursor, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(page); !equalIDs(got, []string{"post4", "post5"}) {
+			t.Fatalf("unexpected third page %v", got)
+		}
+		if page[1].Data.score != 1000 {
+			t.Errorf("expected the current data to be served, got score %v", page[1].Data.score)
+		}
+		if cursor != "" {
+			t.Errorf("expected an empty cursor at the end, got %q", cursor)
+		}
+	})
+
+	t.Run("feeds missing from data are skipped", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{})
+
+		_, cursor, err := svc.GetFeedsPage(ctx, data, "", 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		page, _, err := svc.GetFeedsPage(ctx, []MockPost{data[0], data[3], data[4], {id: "new", score: 100}}, cursor, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(page); !equalIDs(got, []string{"post4", "post5"}) {
+			t.Fatalf("unexpected page %v", got)
+		}
+	})
+
+	t.Run("limit is the page size for end-anchored pins", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{{FeedId: "pinned", FeedType: model.TypePost, Position: 0, Anchor: model.AnchorEnd}},
+		})
+
+		page, _, err := svc.GetFeedsPage(ctx, data, "", 3)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(page); !equalIDs(got, []string{"post1", "post2", "pinned"}) {
+			t.Fatalf("unexpected page %v", got)
+		}
+	})
+
+	t.Run("long feeds carry a compressed cursor any instance serves", func(t *testing.T) {
+		var long []MockPost
+		var ids []string
+		for i := 0; i < 200; i++ {
+			long = append(long, MockPost{id: fmt.Sprintf("post%03d", i), feedType: model.TypePost, score: float64(1000 - i)})
+			ids = append(ids, fmt.Sprintf("post%03d", i))
+		}
+
+		_, cursor, err := NewFeed[MockPost](&mockStore{}).GetFeedsPage(ctx, long, "", 5)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if raw := len(strings.Join(ids, "")); len(cursor) >= raw/2 {
+			t.Errorf("expected a compressed cursor, got %d bytes for %d bytes of ids", len(cursor), raw)
+		}
+		page, _, err := NewFeed[MockPost](&mockStore{}).GetFeedsPage(ctx, long, cursor, 5)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(page); !equalIDs(got, []string{"post005", "post006", "post007", "post008", "post009"}) {
+			t.Fatalf("unexpected second page %v", got)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{})
+		for _, cursor := range []string{"not base64!", "bm90IGpzb24", "eyJ2Ijo5OSwiaWRzIjpbImEiXX0", "Q1YqU7KytNRRykwpVrKKVkpUiq0FAA"} {
+			if _, _, err := svc.GetFeedsPage(ctx, data, cursor, 2); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("cursor %q: expected ErrInvalidCursor, got %v", cursor, err)
+			}
+		}
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{})
+		if _, _, err := svc.GetFeedsPage(ctx, data, "", 0); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{policiesErr: errors.New("database error")})
+		if _, _, err := svc.GetFeedsPage(ctx, data, "", 2); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"sort"
+
+	"github.com/A-pen-app/feed-sdk/model"
+	"github.com/A-pen-app/logging"
+)
+
+// Reranker is a stage of the GetFeeds pipeline. It takes the feeds as the
+// previous stage left them and returns them reordered, and possibly with
+// feeds removed. A stage failing fails GetFeeds.
+type Reranker[T model.Scorable] interface {
+	Rerank(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error)
+}
+
+// RerankerFunc adapts a function to a Reranker.
+type RerankerFunc[T model.Scorable] func(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error)
+
+func (r RerankerFunc[T]) Rerank(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error) {
+	return r(ctx, feeds)
+}
+
+// SetPipeline replaces the stages GetFeeds runs, in order, on the feeds built
+// from its data. The default pipeline is
+//
+//	f.ScoreStage(), f.DedupStage(), f.DiversityStage(), f.PinStage(), f.ColdstartStage()
+//
+// Custom stages (boosts, dedup, ...) usually go between sorting and the pin
+// and coldstart stages, so those keep inserting at exact positions. The pin
+// stage goes before the coldstart stage, which inserts around the pins. With
+// no stages, GetFeeds returns the feeds in data order.
+//
+// SetPipeline is meant for setting the service up: it must not be called
+// while GetFeeds is running.
+func (f *Service[T]) SetPipeline(stages ...Reranker[T]) {
+	f.pipeline = append([]Reranker[T]{}, stages...)
+}
+
+// Pipeline returns the stages GetFeeds runs.
+func (f *Service[T]) Pipeline() []Reranker[T] {
+	if f.pipeline == nil {
+		return []Reranker[T]{f.ScoreStage(), f.DedupStage(), f.DiversityStage(), f.PinStage(), f.ColdstartStage()}
+	}
+	return append([]Reranker[T]{}, f.pipeline...)
+}
+
+func (f *Service[T]) rerank(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error) {
+	ctx, t := withTracer(ctx, feeds)
+	ctx = withRequest(ctx)
+	for i, stage := range f.Pipeline() {
+		var before model.Feeds[T]
+		if t != nil {
+			// stages may reuse the backing array
+			before = slices.Clone(feeds)
+		}
+		var err error
+		feeds, err = stage.Rerank(ctx, feeds)
+		if err != nil {
+			return nil, err
+		}
+		stageRemoved(t, i, before, feeds)
+	}
+	finish(t, feeds)
+	return feeds, nil
+}
+
+// SortStage sorts the feeds by descending score, breaking ties with the tie
+// breakers (see WithTieBreakers).
+func (f *Service[T]) SortStage() Reranker[T] {
+	return RerankerFunc[T](func(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error) {
+		feeds.SortWith(ctx, f.tieBreak...)
+		ranked(tracerFrom(ctx), feeds, func(i int) float64 { return feeds[i].Data.Score() })
+		return feeds, nil
+	})
+}
+
+// DedupStage keeps one feed per id. Of several copies of a feed, the pinned
+// copy is kept when one has the type the feed is pinned with (posts for the
+// members of a posts group), the highest ranked otherwise. It takes the place
+// of the first copy.
+func (f *Service[T]) DedupStage() Reranker[T] {
+	return RerankerFunc[T](f.dedup)
+}
+
+// KeyCapStage lets at most perKey feeds of each key (see model.Keyed, e.g. the
+// author) into the first top feeds; the others are moved right after them.
+// Pinned and coldstart feeds inserted later are not counted.
+func (f *Service[T]) KeyCapStage(perKey, top int) Reranker[T] {
+	return RerankerFunc[T](func(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error) {
+		return feeds.CapPerKey(perKey, top), nil
+	})
+}
+
+// DiversityStage reorders the feeds by the type diversity rules (see
+// WithDiversity). The feeds a later PinStage or ColdstartStage inserts keep
+// their indexes and are not subject to the rules.
+func (f *Service[T]) DiversityStage() Reranker[T] {
+	return RerankerFunc[T](f.diversify)
+}
+
+// ColdstartStage inserts up to 5 coldstart feeds at random indexes among the
+// first 10 when COLD_START_KEY is set, and does nothing otherwise. The
+// coldstart feeds are COLD_START_IDS_KEY when set, the feed_coldstart table
+// otherwise. Feeds pinned by an earlier PinStage keep their indexes: coldstart
+// feeds take the free ones, past the first 10 only when too few are left, and
+// a pinned feed is not inserted again as a coldstart feed.
+func (f *Service[T]) ColdstartStage() Reranker[T] {
+	return RerankerFunc[T](f.insertColdstart)
+}
+
+// PinStage places the pinned feeds at their positions, serving each posts slot
+// with one post of its group. When COLD_START_KEY is set, only the pins that
+// apply to coldstart feeds (see SetPinColdstart) are placed. Pins past the end
+// of the feed are handled as set by WithPinGaps.
+func (f *Service[T]) PinStage() Reranker[T] {
+	return RerankerFunc[T](f.insertPins)
+}
+
+func (f *Service[T]) diversify(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error) {
+	if !f.diversity.Enabled() {
+		return feeds, nil
+	}
+
+	inserted, err := f.pinnedTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if coldstart, _ := ctx.Value(model.COLD_START_KEY).(bool); coldstart {
+		ids, _, err := f.coldstartPicks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			inserted[id] = ""
+		}
+	}
+
+	fixed := make(map[int]model.Feed[T])
+	others := feeds[:0:0]
+	for i, feed := range feeds {
+		if _, ok := inserted[feed.ID]; ok {
+			fixed[i] = feed
+		} else {
+			others = append(others, feed)
+		}
+	}
+	others = others.Diversify(f.diversity)
+
+	out := make(model.Feeds[T], 0, len(feeds))
+	for i := range feeds {
+		if feed, ok := fixed[i]; ok {
+			out = append(out, feed)
+		} else {
+			out, others = append(out, others[0]), others[1:]
+		}
+	}
+	return out, nil
+}
+
+func (f *Service[T]) insertColdstart(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error) {
+	if coldstart, _ := ctx.Value(model.COLD_START_KEY).(bool); !coldstart {
+		return feeds, nil
+	}
+	position, _ := ctx.Value(model.POSITION_KEY).(string)
+	logging.Infow(ctx, "coldstart feed retrieval", "position", position)
+
+	idList, audience, err := f.coldstartPicks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build set of coldstart feed IDs
+	coldstartIDs := make(map[string]bool)
+	for _, id := range idList {
+		coldstartIDs[id] = true
+	}
+
+	// Take coldstart and pinned feeds out of the list, pins keeping their
+	// index
+	placed := placedFrom(ctx)
+	pinnedAt := make(map[int]model.Feed[T])
+	var coldstartFeeds []model.Feed[T]
+	others := feeds[:0:0]
+	for i, feed := range feeds {
+		switch {
+		case placed[feed.ID]:
+			pinnedAt[i] = feed
+		case coldstartIDs[feed.ID]:
+			coldstartFeeds = append(coldstartFeeds, feed)
+		default:
+			others = append(others, feed)
+		}
+	}
+
+	// Pick random free indexes in first 10
+	var free []int
+	for i := 0; i < 10 || len(free) < len(coldstartFeeds); i++ {
+		if _, pinned := pinnedAt[i]; !pinned {
+			free = append(free, i)
+		}
+	}
+	randomPositions := make([]int, len(coldstartFeeds))
+	for i, j := range rand.Perm(len(free))[:len(coldstartFeeds)] {
+		randomPositions[i] = free[j]
+	}
+	sort.Ints(randomPositions)
+
+	t := tracerFrom(ctx)
+	out := make(model.Feeds[T], 0, len(feeds))
+	var c, o int
+	for i := 0; len(out) < len(feeds); i++ {
+		if feed, pinned := pinnedAt[i]; pinned {
+			out = append(out, feed)
+			continue
+		}
+		// short feeds get the rest appended
+		if c < len(coldstartFeeds) && (randomPositions[c] == i || o == len(others)) {
+			out = append(out, coldstartFeeds[c])
+			t.coldstart(coldstartFeeds[c].ID, audience)
+			c++
+			continue
+		}
+		if o < len(others) {
+			out = append(out, others[o])
+			o++
+		}
+	}
+	return out, nil
+}
+
+func (f *Service[T]) insertPins(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error) {
+	positions, err := f.pins(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// serve each posts slot with the first eligible member of its group
+	positions, feeds, err = f.resolveRelations(ctx, positions, feeds)
+	if err != nil {
+		return nil, err
+	}
+
+	// create a position map to speed up the discovery of positioned feeds.
+	positionMap := make(map[string]model.Policy)
+	for _, position := range positions {
+		positionMap[position.FeedId] = position
+	}
+
+	// create a feed id->feed map of the positioned feeds
+	positionedFeedMap := make(map[string]model.Feed[T])
+
+	nonPositionedFeeds := feeds[:0]
+	for i := 0; i < len(feeds); i++ {
+		if _, exists := positionMap[feeds[i].ID]; exists {
+			// if the feed is positioned, put it into map
+			positionedFeedMap[feeds[i].ID] = feeds[i]
+		} else {
+			// collect it otherwise
+			nonPositionedFeeds = append(nonPositionedFeeds, feeds[i])
+		}
+	}
+	feeds = nonPositionedFeeds
+
+	// only pins that are in the data take up an index
+	present := positions[:0:0]
+	for _, p := range positions {
+		if _, exist := positionedFeedMap[p.FeedId]; exist {
+			present = append(present, p)
+		}
+	}
+
+	placements := placePins(present, len(feeds)+len(present), pageSize(ctx))
+	feeds, placements = f.fillGaps(ctx, feeds, placements, positionedFeedMap)
+
+	t := tracerFrom(ctx)
+	placed := placedFrom(ctx)
+	for _, p := range placements {
+		feed := positionedFeedMap[p.feedID]
+		t.pinned(p.feedID, positionMap[p.feedID])
+		if placed != nil {
+			placed[p.feedID] = true
+		}
+		if len(feeds) < p.index {
+			feeds = append(feeds, feed)
+		} else {
+			feeds = slices.Insert(feeds, p.index, feed)
+		}
+	}
+	return feeds, nil
+}
+
+func (f *Service[T]) dedup(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error) {
+	seen := make(map[string]bool, len(feeds))
+	var duplicated bool
+	for _, feed := range feeds {
+		if seen[feed.ID] {
+			duplicated = true
+			break
+		}
+		seen[feed.ID] = true
+	}
+	if !duplicated {
+		return feeds, nil
+	}
+
+	pinned, err := f.pinnedTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(feeds))
+	out := feeds[:0:0]
+	for _, feed := range feeds {
+		i, exists := index[feed.ID]
+		if !exists {
+			index[feed.ID] = len(out)
+			out = append(out, feed)
+			continue
+		}
+		if t, ok := pinned[feed.ID]; ok && out[i].Type != t && feed.Type == t {
+			out[i] = feed
+		}
+	}
+	return out, nil
+}
+
+// pins returns the pins that apply to the request: only those flagged
+// Coldstart when COLD_START_KEY is set.
+func (f *Service[T]) pins(ctx context.Context) ([]model.Policy, error) {
+	positions, err := f.policies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if coldstart, _ := ctx.Value(model.COLD_START_KEY).(bool); !coldstart {
+		return positions, nil
+	}
+	applying := positions[:0:0]
+	for _, p := range positions {
+		if p.Coldstart {
+			applying = append(applying, p)
+		}
+	}
+	return applying, nil
+}
+
+// pinnedTypes maps the id of every feed that may be pinned to the type it is
+// pinned with.
+func (f *Service[T]) pinnedTypes(ctx context.Context) (map[string]model.FeedType, error) {
+	pinned := make(map[string]model.FeedType)
+	positions, err := f.pins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var groups bool
+	for _, p := range positions {
+		pinned[p.FeedId] = p.FeedType
+		groups = groups || p.FeedType == model.TypePosts
+	}
+	if !groups {
+		return pinned, nil
+	}
+
+	relations, err := f.relations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, relation := range relations {
+		if _, ok := pinned[relation.FeedId]; !ok {
+			pinned[relation.FeedId] = model.TypePosts
+		}
+	}
+	return pinned, nil
+}
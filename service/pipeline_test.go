@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+func TestGetFeeds_Pipeline(t *testing.T) {
+	ctx := context.Background()
+	data := []MockPost{
+		{id: "post1", feedType: model.TypePost, score: 90},
+		{id: "chat1", feedType: model.TypeChat, score: 80},
+		{id: "post2", feedType: model.TypePost, score: 70},
+		{id: "pinned", feedType: model.TypePost, score: 1},
+	}
+	pins := []model.Policy{{FeedId: "pinned", FeedType: model.TypePost, Position: 0}}
+
+	// chatFirst moves chats ahead of everything else, keeping the order
+	chatFirst := RerankerFunc[MockPost](func(ctx context.Context, feeds model.Feeds[MockPost]) (model.Feeds[MockPost], error) {
+		out := make(model.Feeds[MockPost], 0, len(feeds))
+		for _, feed := range feeds {
+			if feed.Type == model.TypeChat {
+				out = append(out, feed)
+			}
+		}
+		for _, feed := range feeds {
+			if feed.Type != model.TypeChat {
+				out = append(out, feed)
+			}
+		}
+		return out, nil
+	})
+	// dropPost2 removes a feed
+	dropPost2 := RerankerFunc[MockPost](func(ctx context.Context, feeds model.Feeds[MockPost]) (model.Feeds[MockPost], error) {
+		out := feeds[:0]
+		for _, feed := range feeds {
+			if feed.ID != "post2" {
+				out = append(out, feed)
+			}
+		}
+		return out, nil
+	})
+
+	tests := []struct {
+		name     string
+		pipeline func(svc *Service[MockPost]) []Reranker[MockPost]
+		expected []string
+	}{
+		{
+			name:     "default pipeline",
+			expected: []string{"pinned", "post1", "chat1", "post2"},
+		},
+		{
+			name: "custom stages run between sort and pins",
+			pipeline: func(svc *Service[MockPost]) []Reranker[MockPost] {
+				return []Reranker[MockPost]{svc.SortStage(), chatFirst, dropPost2, svc.PinStage(), svc.ColdstartStage()}
+			},
+			expected: []string{"pinned", "chat1", "post1"},
+		},
+		{
+			name: "stages run in order",
+			pipeline: func(svc *Service[MockPost]) []Reranker[MockPost] {
+				return []Reranker[MockPost]{chatFirst, svc.SortStage(), svc.PinStage()}
+			},
+			expected: []string{"pinned", "post1", "chat1", "post2"},
+		},
+		{
+			name: "empty pipeline keeps the data order",
+			pipeline: func(svc *Service[MockPost]) []Reranker[MockPost] {
+				return nil
+			},
+			expected: []string{"post1", "chat1", "post2", "pinned"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewFeed[MockPost](&mockStore{policies: pins})
+			if tt.pipeline != nil {
+				svc.SetPipeline(tt.pipeline(svc)...)
+			}
+
+			feeds, err := svc.GetFeeds(ctx, data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := pageIDs(feeds); !equalIDs(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("a failing stage fails GetFeeds", func(t *testing.T) {
+		stageErr := errors.New("stage error")
+		svc := NewFeed[MockPost](&mockStore{policies: pins})
+		svc.SetPipeline(svc.SortStage(), RerankerFunc[MockPost](func(ctx context.Context, feeds model.Feeds[MockPost]) (model.Feeds[MockPost], error) {
+			return nil, stageErr
+		}), svc.PinStage())
+
+		if _, err := svc.GetFeeds(ctx, data); !errors.Is(err, stageErr) {
+			t.Errorf("expected %v, got %v", stageErr, err)
+		}
+	})
+
+	t.Run("Pipeline returns the stages", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{})
+		if got := len(svc.Pipeline()); got != 5 {
+			t.Fatalf("expected 5 default stages, got %d", got)
+		}
+		svc.SetPipeline(svc.SortStage())
+		stages := svc.Pipeline()
+		stages[0] = chatFirst
+		if got := len(svc.Pipeline()); got != 1 {
+			t.Fatalf("expected 1 stage, got %d", got)
+		}
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if feeds[0].ID != "post1" {
+			t.Errorf("expected the pipeline not to change through the returned slice, got %v first", feeds[0].ID)
+		}
+	})
+}
+
+func TestGetFeeds_Dedup(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		store     *mockStore
+		coldstart bool
+		data      []MockPost
+		expected  []string
+		typeOf    string
+		typeIsFor model.FeedType
+	}{
+		{
+			name:  "highest ranked copy is kept",
+			store: &mockStore{},
+			data: []MockPost{
+				{id: "post1", feedType: model.TypePost, score: 90},
+				{id: "post2", feedType: model.TypePost, score: 80},
+				{id: "post1", feedType: model.TypeChat, score: 10},
+			},
+			expected:  []string{"post1", "post2"},
+			typeOf:    "post1",
+			typeIsFor: model.TypePost,
+		},
+		{
+			name: "pinned copy wins",
+			store: &mockStore{
+				policies: []model.Policy{{FeedId: "post1", FeedType: model.TypePosts, Position: 1}},
+			},
+			data: []MockPost{
+				{id: "post1", feedType: model.TypePost, score: 90},
+				{id: "post2", feedType: model.TypePost, score: 80},
+				{id: "post3", feedType: model.TypePost, score: 70},
+				{id: "post1", feedType: model.TypePosts, score: 10},
+			},
+			expected:  []string{"post2", "post1", "post3"},
+			typeOf:    "post1",
+			typeIsFor: model.TypePosts,
+		},
+		{
+			name: "group member copy wins",
+			store: &mockStore{
+				policies:  []model.Policy{{FeedId: "holder", FeedType: model.TypePosts, Position: 0}},
+				relations: []model.Relation{{FeedId: "member", RelatedFeedId: "holder", Weight: 1}},
+			},
+			data: []MockPost{
+				{id: "member", feedType: model.TypePost, score: 90},
+				{id: "post2", feedType: model.TypePost, score: 80},
+				{id: "member", feedType: model.TypePosts, score: 10},
+			},
+			expected:  []string{"member", "post2"},
+			typeOf:    "member",
+			typeIsFor: model.TypePosts,
+		},
+		{
+			name:      "coldstart pins in a coldstart feed",
+			coldstart: true,
+			store: &mockStore{
+				policies: []model.Policy{{FeedId: "post1", FeedType: model.TypePosts, Position: 1, Coldstart: true}},
+			},
+			data: []MockPost{
+				{id: "post1", feedType: model.TypePost, score: 90},
+				{id: "post1", feedType: model.TypePosts, score: 10},
+			},
+			expected:  []string{"post1"},
+			typeOf:    "post1",
+			typeIsFor: model.TypePosts,
+		},
+		{
+			name:      "other pins not in a coldstart feed",
+			coldstart: true,
+			store: &mockStore{
+				policies: []model.Policy{{FeedId: "post1", FeedType: model.TypePosts, Position: 1}},
+			},
+			data: []MockPost{
+				{id: "post1", feedType: model.TypePost, score: 90},
+				{id: "post1", feedType: model.TypePosts, score: 10},
+			},
+			expected:  []string{"post1"},
+			typeOf:    "post1",
+			typeIsFor: model.TypePost,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := ctx
+			if tt.coldstart {
+				ctx = context.WithValue(ctx, model.COLD_START_KEY, true)
+				ctx = context.WithValue(ctx, model.COLD_START_IDS_KEY, []string{"other"})
+			}
+			svc := NewFeed[MockPost](tt.store)
+
+			feeds, err := svc.GetFeeds(ctx, tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := pageIDs(feeds); !equalIDs(got, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+			for _, feed := range feeds {
+				if feed.ID == tt.typeOf && feed.Type != tt.typeIsFor {
+					t.Errorf("expected the %v copy of %v, got %v", tt.typeIsFor, tt.typeOf, feed.Type)
+				}
+			}
+		})
+	}
+
+	t.Run("pins and relations are read once per request", func(t *testing.T) {
+		store := &mockStore{
+			policies:  []model.Policy{{FeedId: "holder", FeedType: model.TypePosts, Position: 0}},
+			relations: []model.Relation{{FeedId: "member", RelatedFeedId: "holder"}},
+		}
+		svc := NewFeed[MockPost](store)
+
+		feeds, err := svc.GetFeeds(ctx, []MockPost{
+			{id: "post1", feedType: model.TypePost, score: 90},
+			{id: "member", feedType: model.TypePost, score: 80},
+			{id: "member", feedType: model.TypePosts, score: 10},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := pageIDs(feeds); !equalIDs(got, []string{"member", "post1"}) {
+			t.Errorf("unexpected feeds %v", got)
+		}
+		if store.policiesCalls != 1 || store.relationsCalls != 1 {
+			t.Errorf("expected one read each, got %d pin and %d relation reads", store.policiesCalls, store.relationsCalls)
+		}
+	})
+
+	t.Run("store is not queried without duplicates", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{policiesErr: errors.New("database error")})
+		svc.SetPipeline(svc.SortStage(), svc.DedupStage())
+
+		if _, err := svc.GetFeeds(ctx, []MockPost{{id: "post1"}, {id: "post2"}}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := svc.GetFeeds(ctx, []MockPost{{id: "post1"}, {id: "post1"}}); err == nil {
+			t.Error("expected error but got none")
+		}
+	})
+}
+
+func TestGetFeeds_ColdstartPins(t *testing.T) {
+	ctx := context.WithValue(context.Background(), model.COLD_START_KEY, true)
+	ctx = context.WithValue(ctx, model.COLD_START_IDS_KEY, []string{"cold1", "cold2"})
+
+	data := []MockPost{
+		{id: "cold1", feedType: model.TypePost, score: 2},
+		{id: "cold2", feedType: model.TypePost, score: 2},
+		{id: "pinned", feedType: model.TypePost, score: 1},
+	}
+	for i := 0; i < 12; i++ {
+		data = append(data, MockPost{id: fmt.Sprintf("post%d", i), feedType: model.TypePost, score: float64(100 - i)})
+	}
+
+	indexOf := func(feeds model.Feeds[MockPost], id string) int {
+		for i, feed := range feeds {
+			if feed.ID == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	t.Run("coldstart pins keep their position", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{{FeedId: "pinned", FeedType: model.TypePost, Position: 2, Coldstart: true}},
+		})
+		// coldstart indexes are random
+		for run := 0; run < 50; run++ {
+			feeds, err := svc.GetFeeds(ctx, data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(feeds) != len(data) {
+				t.Fatalf("expected %d feeds, got %d", len(data), len(feeds))
+			}
+			if i := indexOf(feeds, "pinned"); i != 2 {
+				t.Fatalf("expected pinned at 2, got %d in %v", i, pageIDs(feeds))
+			}
+			for _, id := range []string{"cold1", "cold2"} {
+				if i := indexOf(feeds, id); i < 0 || i >= 10 {
+					t.Fatalf("expected %v in the first 10, got %d in %v", id, i, pageIDs(feeds))
+				}
+			}
+		}
+	})
+
+	t.Run("other pins are not placed", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{{FeedId: "pinned", FeedType: model.TypePost, Position: 2}},
+		})
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if i := indexOf(feeds, "pinned"); i != len(feeds)-1 {
+			t.Errorf("expected pinned ranked last, got %d in %v", i, pageIDs(feeds))
+		}
+	})
+
+	t.Run("a pinned coldstart feed is placed once", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{{FeedId: "cold1", FeedType: model.TypePost, Position: 12, Coldstart: true}},
+		})
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(feeds) != len(data) {
+			t.Fatalf("expected %d feeds, got %d", len(data), len(feeds))
+		}
+		if i := indexOf(feeds, "cold1"); i != 12 {
+			t.Errorf("expected cold1 pinned at 12, got %d", i)
+		}
+	})
+
+	t.Run("coldstart feeds move past the first 10 when pins fill them", func(t *testing.T) {
+		var pins []model.Policy
+		for i := 0; i < 9; i++ {
+			pins = append(pins, model.Policy{FeedId: fmt.Sprintf("post%d", i), FeedType: model.TypePost, Position: i, Coldstart: true})
+		}
+		svc := NewFeed[MockPost](&mockStore{policies: pins})
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i := 0; i < 9; i++ {
+			if feeds[i].ID != pins[i].FeedId {
+				t.Fatalf("expected %v at %d, got %v", pins[i].FeedId, i, pageIDs(feeds))
+			}
+		}
+		if i, j := indexOf(feeds, "cold1"), indexOf(feeds, "cold2"); i+j != 19 {
+			t.Errorf("expected coldstart feeds at 9 and 10, got %d and %d", i, j)
+		}
+	})
+}
+
+type authoredPost struct {
+	MockPost
+	author string
+}
+
+func (a authoredPost) GetKey() string {
+	return a.author
+}
+
+func TestGetFeeds_KeyCap(t *testing.T) {
+	ctx := context.Background()
+	post := func(id, author string, score float64) authoredPost {
+		return authoredPost{MockPost: MockPost{id: id, feedType: model.TypePost, score: score}, author: author}
+	}
+	data := []authoredPost{
+		post("a1", "alice", 90),
+		post("a2", "alice", 80),
+		post("a3", "alice", 70),
+		post("b1", "bob", 60),
+		post("b2", "bob", 50),
+		post("pinned", "alice", 1),
+	}
+
+	svc := NewFeed[authoredPost](&mockStore{
+		policies: []model.Policy{{FeedId: "pinned", FeedType: model.TypePost, Position: 1}},
+	})
+	svc.SetPipeline(svc.SortStage(), svc.DedupStage(), svc.KeyCapStage(1, 2), svc.PinStage(), svc.ColdstartStage())
+
+	feeds, err := svc.GetFeeds(ctx, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"a1", "pinned", "b1", "a2", "a3", "b2"}
+	var got []string
+	for _, feed := range feeds {
+		got = append(got, feed.ID)
+	}
+	if !equalIDs(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
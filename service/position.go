@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+// placement is the index a pinned feed is inserted at.
+type placement struct {
+	feedID string
+	index  int
+}
+
+// pageSize returns the first page size carried under model.PAGE_SIZE_KEY, or 0
+// when none is set.
+func pageSize(ctx context.Context) int {
+	size, _ := ctx.Value(model.PAGE_SIZE_KEY).(int)
+	return size
+}
+
+// placePins resolves every pin into a distinct index of a list of total feeds,
+// returned by ascending index. Exact pins are placed first, at their position;
+// range pins then land on a random free index of their range, keeping their
+// spacing (and that of the pins around them) when the range allows it, and on
+// the first free index after the range when it is full. AnchorEnd positions
+// count back from the end of the first page, of size page or total when page
+// is not positive.
+func placePins(pins []model.Policy, total, page int) []placement {
+	if page <= 0 {
+		page = total
+	}
+
+	// resolve anchors into [lo, hi] index ranges
+	type pin struct {
+		model.Policy
+		lo, hi int
+	}
+	resolved := make([]pin, len(pins))
+	for i, p := range pins {
+		lo, hi := p.Position, p.Position
+		if p.MaxPosition != nil && *p.MaxPosition > hi {
+			hi = *p.MaxPosition
+		}
+		if p.Anchor == model.AnchorEnd {
+			lo, hi = max(page-1-hi, 0), max(page-1-lo, 0)
+		}
+		resolved[i] = pin{Policy: p, lo: lo, hi: hi}
+	}
+
+	// exact pins first, each kind by position
+	sort.SliceStable(resolved, func(i, j int) bool {
+		iRange, jRange := resolved[i].MaxPosition != nil, resolved[j].MaxPosition != nil
+		if iRange != jRange {
+			return !iRange
+		}
+		return resolved[i].lo < resolved[j].lo
+	})
+
+	taken := make(map[int]int) // index -> spacing of the pin there
+	spaced := func(index, spacing int) bool {
+		for other, otherSpacing := range taken {
+			gap := index - other
+			if gap < 0 {
+				gap = -gap
+			}
+			if gap <= max(spacing, otherSpacing) {
+				return false
+			}
+		}
+		return true
+	}
+	nextFree := func(from int) int {
+		for {
+			if _, ok := taken[from]; !ok {
+				return from
+			}
+			from++
+		}
+	}
+
+	placements := make([]placement, 0, len(resolved))
+	for _, p := range resolved {
+		index := -1
+		if p.MaxPosition == nil {
+			index = nextFree(p.lo)
+		} else {
+			var free, spacedFree []int
+			for i := p.lo; i <= p.hi; i++ {
+				if _, ok := taken[i]; ok {
+					continue
+				}
+				free = append(free, i)
+				if spaced(i, p.MinSpacing) {
+					spacedFree = append(spacedFree, i)
+				}
+			}
+			switch {
+			case len(spacedFree) > 0:
+				index = spacedFree[rand.Intn(len(spacedFree))]
+			case len(free) > 0:
+				index = free[rand.Intn(len(free))]
+			default:
+				index = nextFree(p.hi + 1)
+			}
+		}
+		taken[index] = p.MinSpacing
+		placements = append(placements, placement{feedID: p.FeedId, index: index})
+	}
+
+	sort.Slice(placements, func(i, j int) bool {
+		return placements[i].index < placements[j].index
+	})
+	return placements
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestPlacePins(t *testing.T) {
+	tests := []struct {
+		name     string
+		pins     []model.Policy
+		total    int
+		page     int
+		expected map[string][]int // feed id -> acceptable indices
+	}{
+		{
+			name: "exact pins stay put",
+			pins: []model.Policy{
+				{FeedId: "a", Position: 0},
+				{FeedId: "b", Position: 3},
+			},
+			total:    10,
+			expected: map[string][]int{"a": {0}, "b": {3}},
+		},
+		{
+			name: "range pin lands inside its range",
+			pins: []model.Policy{
+				{FeedId: "a", Position: 3, MaxPosition: intPtr(6)},
+			},
+			total:    10,
+			expected: map[string][]int{"a": {3, 4, 5, 6}},
+		},
+		{
+			name: "range pin avoids exact pins and keeps spacing",
+			pins: []model.Policy{
+				{FeedId: "a", Position: 3, MaxPosition: intPtr(6), MinSpacing: 1},
+				{FeedId: "b", Position: 4},
+			},
+			total:    10,
+			expected: map[string][]int{"a": {6}, "b": {4}},
+		},
+		{
+			name: "spacing of the exact pin is honoured too",
+			pins: []model.Policy{
+				{FeedId: "a", Position: 2, MaxPosition: intPtr(7)},
+				{FeedId: "b", Position: 3, MinSpacing: 2},
+			},
+			total:    10,
+			expected: map[string][]int{"a": {6, 7}, "b": {3}},
+		},
+		{
+			name: "spacing is dropped when the range cannot honour it",
+			pins: []model.Policy{
+				{FeedId: "a", Position: 3, MaxPosition: intPtr(4), MinSpacing: 3},
+				{FeedId: "b", Position: 4},
+			},
+			total:    10,
+			expected: map[string][]int{"a": {3}, "b": {4}},
+		},
+		{
+			name: "full range overflows past its end",
+			pins: []model.Policy{
+				{FeedId: "a", Position: 1, MaxPosition: intPtr(2)},
+				{FeedId: "b", Position: 1},
+				{FeedId: "c", Position: 2},
+				{FeedId: "d", Position: 3},
+			},
+			total:    10,
+			expected: map[string][]int{"a": {4}, "b": {1}, "c": {2}, "d": {3}},
+		},
+		{
+			name: "end anchor counts back from the page",
+			pins: []model.Policy{
+				{FeedId: "a", Position: 0, Anchor: model.AnchorEnd},
+				{FeedId: "b", Position: 1, MaxPosition: intPtr(2), Anchor: model.AnchorEnd},
+			},
+			total:    30,
+			page:     20,
+			expected: map[string][]int{"a": {19}, "b": {17, 18}},
+		},
+		{
+			name: "end anchor without a page size uses the whole list",
+			pins: []model.Policy{
+				{FeedId: "a", Position: 0, Anchor: model.AnchorEnd},
+			},
+			total:    5,
+			expected: map[string][]int{"a": {4}},
+		},
+		{
+			name: "colliding exact pins move down",
+			pins: []model.Policy{
+				{FeedId: "a", Position: 4},
+				{FeedId: "b", Position: 0, Anchor: model.AnchorEnd},
+			},
+			total:    5,
+			expected: map[string][]int{"a": {4}, "b": {5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// range pins are random, so run a few times
+			for run := 0; run < 20; run++ {
+				placements := placePins(tt.pins, tt.total, tt.page)
+				if len(placements) != len(tt.pins) {
+					t.Fatalf("expected %d placements, got %d", len(tt.pins), len(placements))
+				}
+				seen := map[int]bool{}
+				for i, p := range placements {
+					if i > 0 && placements[i-1].index > p.index {
+						t.Fatalf("placements not sorted: %+v", placements)
+					}
+					if seen[p.index] {
+						t.Fatalf("index %d placed twice: %+v", p.index, placements)
+					}
+					seen[p.index] = true
+					acceptable := tt.expected[p.feedID]
+					ok := false
+					for _, index := range acceptable {
+						ok = ok || index == p.index
+					}
+					if !ok {
+						t.Fatalf("%s placed at %d, expected one of %v", p.feedID, p.index, acceptable)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGetFeeds_RangePins(t *testing.T) {
+	input := []MockPost{
+		{id: "post1", feedType: model.TypePost, score: 90},
+		{id: "post2", feedType: model.TypePost, score: 80},
+		{id: "post3", feedType: model.TypePost, score: 70},
+		{id: "post4", feedType: model.TypePost, score: 60},
+		{id: "pinned", feedType: model.TypePost, score: 10},
+		{id: "last", feedType: model.TypePost, score: 5},
+	}
+	store := &mockStore{
+		policies: []model.Policy{
+			{FeedId: "pinned", FeedType: model.TypePost, Position: 1, MaxPosition: intPtr(3)},
+			{FeedId: "last", FeedType: model.TypePost, Position: 0, Anchor: model.AnchorEnd},
+		},
+	}
+	svc := NewFeed[MockPost](store)
+	ctx := context.WithValue(context.Background(), model.PAGE_SIZE_KEY, 5)
+
+	for run := 0; run < 20; run++ {
+		feeds, err := svc.GetFeeds(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(feeds) != len(input) {
+			t.Fatalf("expected %d feeds, got %d", len(input), len(feeds))
+		}
+		if feeds[4].ID != "last" {
+			t.Errorf("expected the end-anchored pin last on the page, got %s", feeds[4].ID)
+		}
+		index := -1
+		for i, feed := range feeds {
+			if feed.ID == "pinned" {
+				index = i
+			}
+		}
+		if index < 1 || index > 3 {
+			t.Errorf("range pin at %d, expected 1-3", index)
+		}
+	}
+}
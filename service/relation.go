@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/A-pen-app/feed-sdk/model"
+	"github.com/A-pen-app/logging"
+)
+
+// resolveRelations decides which member of each posts group is served in the
+// group's slot. The candidates are the holder, then its relation members in
+// promotion order, that are present in feeds, not pinned elsewhere and whose policies are
+// not violated; the rotation picks one of them. The holder's own policies are
+// left to the caller, as for any other pin.
+//
+// Members whose policies are violated are removed from feeds altogether, so a
+// capped or untargeted member does not resurface as a regular feed.
+func (f *Service[T]) resolveRelations(ctx context.Context, positions []model.Policy, feeds model.Feeds[T]) ([]model.Policy, model.Feeds[T], error) {
+	if !slices.ContainsFunc(positions, func(p model.Policy) bool {
+		return p.FeedType == model.TypePosts
+	}) {
+		return positions, feeds, nil
+	}
+
+	relations, err := f.relations(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(relations) == 0 {
+		return positions, feeds, nil
+	}
+
+	present := make(map[string]bool, len(feeds))
+	for _, feed := range feeds {
+		present[feed.ID] = true
+	}
+
+	// only members that could be served need their policies evaluated
+	members := make(map[string][]model.Relation)
+	policyMap := make(map[string]*model.Policy)
+	for _, relation := range relations {
+		members[relation.RelatedFeedId] = append(members[relation.RelatedFeedId], relation)
+		if present[relation.FeedId] && len(relation.Policies) > 0 {
+			policyMap[relation.FeedId] = &model.Policy{
+				FeedId:   relation.FeedId,
+				FeedType: model.TypePosts,
+				Policies: relation.Policies,
+			}
+		}
+	}
+
+	userID, _ := ctx.Value(model.USER_ID_KEY).(string)
+	violation := map[string]string{}
+	if f.resolver != nil && len(policyMap) > 0 {
+		violation = f.BuildPolicyViolationMap(ctx, userID, policyMap, f.resolver)
+	}
+
+	taken := make(map[string]bool, len(positions))
+	for _, p := range positions {
+		taken[p.FeedId] = true
+	}
+
+	rotation := f.rotation
+	if rotation == nil {
+		rotation = model.RotationFixed
+	}
+
+	resolved := make([]model.Policy, len(positions))
+	copy(resolved, positions)
+	for i, p := range resolved {
+		if p.FeedType != model.TypePosts {
+			continue
+		}
+		var candidates []model.Candidate
+		if present[p.FeedId] {
+			candidates = append(candidates, model.Candidate{FeedId: p.FeedId, Weight: 1})
+		}
+		for _, member := range members[p.FeedId] {
+			if present[member.FeedId] && !taken[member.FeedId] && violation[member.FeedId] == "" {
+				candidates = append(candidates, model.Candidate{FeedId: member.FeedId, Weight: member.Weight})
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		chosen := candidates[0].FeedId
+		if len(candidates) > 1 {
+			picked, err := rotation.Pick(ctx, model.Slot{
+				UserId:     userID,
+				HolderId:   p.FeedId,
+				Position:   p.Position,
+				Candidates: candidates,
+				Resolver:   f.resolver,
+			})
+			if err != nil {
+				logging.Errorw(ctx, "rotation failed, serving the first candidate", "position", p.Position, "holder", p.FeedId, "err", err)
+			} else if slices.ContainsFunc(candidates, func(c model.Candidate) bool { return c.FeedId == picked }) {
+				chosen = picked
+			}
+		}
+		if chosen != p.FeedId {
+			logging.Debug(ctx, "posts slot served by relation member", "position", p.Position, "holder", p.FeedId, "feed_id", chosen)
+			tracerFrom(ctx).servedFor(chosen, p.FeedId)
+			resolved[i].FeedId = chosen
+			taken[chosen] = true
+		}
+	}
+
+	if len(violation) > 0 {
+		t := tracerFrom(ctx)
+		feeds = slices.DeleteFunc(feeds, func(feed model.Feed[T]) bool {
+			if violation[feed.ID] == "" {
+				return false
+			}
+			t.removed(feed.ID, violation[feed.ID])
+			return true
+		})
+	}
+	return resolved, feeds, nil
+}
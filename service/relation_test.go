@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/A-pen-app/feed-sdk/model"
+	"github.com/lib/pq"
+)
+
+func TestGetFeeds_Relations(t *testing.T) {
+	// holder is pinned at position 1 with two members queued behind it
+	positions := []model.Policy{
+		{FeedId: "holder", FeedType: model.TypePosts, Position: 1},
+	}
+	relations := []model.Relation{
+		{FeedId: "member1", RelatedFeedId: "holder", Policies: pq.StringArray{"exposure:100"}},
+		{FeedId: "member2", RelatedFeedId: "holder", Policies: pq.StringArray{"istarget:student"}},
+	}
+
+	tests := []struct {
+		name         string
+		input        []MockPost
+		positions    []model.Policy
+		relations    []model.Relation
+		relationsErr error
+		resolver     model.PolicyResolver
+		rotation     model.Rotation
+		userID       string
+		expectedIDs  []string
+		expectedErr  bool
+	}{
+		{
+			name: "holder present is served",
+			input: []MockPost{
+				{id: "holder", feedType: model.TypePosts, score: 10},
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions:   positions,
+			relations:   relations,
+			resolver:    &mockPolicyResolver{},
+			expectedIDs: []string{"member1", "holder", "post1"},
+		},
+		{
+			name: "first eligible member takes the slot",
+			input: []MockPost{
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "member2", feedType: model.TypePost, score: 80},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions: positions,
+			relations: relations,
+			resolver: &mockPolicyResolver{
+				viewCounts: map[string]int64{"member1": 10},
+				userAttrs:  map[string][]string{"user1": {"student"}},
+			},
+			userID:      "user1",
+			expectedIDs: []string{"member2", "member1", "post1"},
+		},
+		{
+			name: "violated member is removed and the group falls back",
+			input: []MockPost{
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "member2", feedType: model.TypePost, score: 80},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions: positions,
+			relations: relations,
+			resolver: &mockPolicyResolver{
+				viewCounts: map[string]int64{"member1": 200},
+				userAttrs:  map[string][]string{"user1": {"student"}},
+			},
+			userID:      "user1",
+			expectedIDs: []string{"post1", "member2"},
+		},
+		{
+			name: "every member violated leaves the slot empty",
+			input: []MockPost{
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "member2", feedType: model.TypePost, score: 80},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions: positions,
+			relations: relations,
+			resolver: &mockPolicyResolver{
+				viewCounts: map[string]int64{"member1": 200},
+			},
+			userID:      "user1",
+			expectedIDs: []string{"post1"},
+		},
+		{
+			name: "member policies do not take effect without a resolver",
+			input: []MockPost{
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions:   positions,
+			relations:   relations,
+			expectedIDs: []string{"post1", "member1"},
+		},
+		{
+			name: "member pinned elsewhere is skipped",
+			input: []MockPost{
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "member2", feedType: model.TypePost, score: 80},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions: []model.Policy{
+				{FeedId: "member1", FeedType: model.TypePost, Position: 0},
+				{FeedId: "holder", FeedType: model.TypePosts, Position: 1},
+			},
+			relations: relations,
+			resolver: &mockPolicyResolver{
+				userAttrs: map[string][]string{"user1": {"student"}},
+			},
+			userID:      "user1",
+			expectedIDs: []string{"member1", "member2", "post1"},
+		},
+		{
+			name: "no posts slot does not query relations",
+			input: []MockPost{
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions: []model.Policy{
+				{FeedId: "post1", FeedType: model.TypePost, Position: 0},
+			},
+			relationsErr: errors.New("should not be called"),
+			expectedIDs:  []string{"post1", "member1"},
+		},
+		{
+			name: "rotation may serve a member over a present holder",
+			input: []MockPost{
+				{id: "holder", feedType: model.TypePosts, score: 10},
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions:   positions,
+			relations:   relations,
+			resolver:    &mockPolicyResolver{viewCounts: map[string]int64{"holder": 500, "member1": 20}},
+			rotation:    model.RotationLeastExposed,
+			expectedIDs: []string{"post1", "member1", "holder"},
+		},
+		{
+			name: "failed rotation serves the first candidate",
+			input: []MockPost{
+				{id: "holder", feedType: model.TypePosts, score: 10},
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions:   positions,
+			relations:   []model.Relation{{FeedId: "member1", RelatedFeedId: "holder"}},
+			rotation:    model.RotationLeastExposed,
+			expectedIDs: []string{"member1", "holder", "post1"},
+		},
+		{
+			name: "weighted rotation uses relation weights",
+			input: []MockPost{
+				{id: "member1", feedType: model.TypePost, score: 90},
+				{id: "member2", feedType: model.TypePost, score: 80},
+				{id: "post1", feedType: model.TypePost, score: 50},
+			},
+			positions: positions,
+			relations: []model.Relation{
+				{FeedId: "member1", RelatedFeedId: "holder", Weight: 0},
+				{FeedId: "member2", RelatedFeedId: "holder", Weight: 1},
+			},
+			rotation:    model.RotationWeightedRandom,
+			expectedIDs: []string{"member1", "member2", "post1"},
+		},
+		{
+			name: "relations error",
+			input: []MockPost{
+				{id: "member1", feedType: model.TypePost, score: 90},
+			},
+			positions:    positions,
+			relationsErr: errors.New("database error"),
+			expectedErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), model.USER_ID_KEY, tt.userID)
+			store := &mockStore{
+				policies:     tt.positions,
+				relations:    tt.relations,
+				relationsErr: tt.relationsErr,
+			}
+			var opts []Option
+			if tt.resolver != nil {
+				opts = append(opts, WithPolicyResolver(tt.resolver))
+			}
+			if tt.rotation != nil {
+				opts = append(opts, WithRotation(tt.rotation))
+			}
+			svc := NewFeed[MockPost](store, opts...)
+
+			feeds, err := svc.GetFeeds(ctx, tt.input)
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(feeds) != len(tt.expectedIDs) {
+				t.Fatalf("expected %d feeds, got %d", len(tt.expectedIDs), len(feeds))
+			}
+			for i, expectedID := range tt.expectedIDs {
+				if feeds[i].ID != expectedID {
+					t.Errorf("at position %d: expected ID %s, got %s", i, expectedID, feeds[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestGetGroups(t *testing.T) {
+	ctx := context.Background()
+	groups := []model.Group{
+		{
+			Holder:  model.Policy{FeedId: "banner", FeedType: model.TypeBanners, Position: 0},
+			Members: []model.Relation{},
+		},
+		{
+			Holder: model.Policy{FeedId: "holder", FeedType: model.TypePosts, Position: 1},
+			Members: []model.Relation{
+				{FeedId: "member1", RelatedFeedId: "holder", Priority: 1},
+				{FeedId: "member2", RelatedFeedId: "holder"},
+			},
+		},
+	}
+
+	t.Run("whole layout", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{groups: groups})
+		got, err := svc.GetGroups(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 || len(got[1].Members) != 2 {
+			t.Fatalf("unexpected groups %+v", got)
+		}
+	})
+
+	t.Run("one slot", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{groups: groups})
+		got, err := svc.GetGroup(ctx, "holder")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Holder.Position != 1 || got.Members[0].FeedId != "member1" {
+			t.Errorf("unexpected group %+v", got)
+		}
+		if _, err := svc.GetGroup(ctx, "member1"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows for a non-holder, got %v", err)
+		}
+	})
+
+	t.Run("reverse lookup", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{groups: groups})
+		got, err := svc.GetGroupsByMember(ctx, "member2")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 1 || got[0].Holder.FeedId != "holder" {
+			t.Errorf("unexpected groups %+v", got)
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{relationsErr: errors.New("database error")})
+		if _, err := svc.GetGroups(ctx); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+}
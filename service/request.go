@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+type requestKey struct{}
+
+// request is what the stages of one rerank share: the pins, relations,
+// boosts and coldstart feeds, read from the store and picked at most once, and
+// the feeds the pin stage placed.
+type request struct {
+	policies       []model.Policy
+	policiesLoaded bool
+
+	relations       []model.Relation
+	relationsLoaded bool
+
+	boosts       []model.Boost
+	boostsLoaded bool
+
+	coldstart       []string
+	audience        string
+	coldstartPicked bool
+
+	placed map[string]bool
+}
+
+func withRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestKey{}, &request{placed: map[string]bool{}})
+}
+
+// requestFrom returns the request state, nil outside a rerank.
+func requestFrom(ctx context.Context) *request {
+	r, _ := ctx.Value(requestKey{}).(*request)
+	return r
+}
+
+// placedFrom returns the ids of the feeds the pin stage placed, nil outside a
+// rerank.
+func placedFrom(ctx context.Context) map[string]bool {
+	if r := requestFrom(ctx); r != nil {
+		return r.placed
+	}
+	return nil
+}
+
+// policies returns every pin, read once per rerank.
+func (f *Service[T]) policies(ctx context.Context) ([]model.Policy, error) {
+	r := requestFrom(ctx)
+	if r != nil && r.policiesLoaded {
+		return r.policies, nil
+	}
+	policies, err := f.store.GetPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		r.policies, r.policiesLoaded = policies, true
+	}
+	return policies, nil
+}
+
+// relations returns every relation, read once per rerank.
+func (f *Service[T]) relations(ctx context.Context) ([]model.Relation, error) {
+	r := requestFrom(ctx)
+	if r != nil && r.relationsLoaded {
+		return r.relations, nil
+	}
+	relations, err := f.store.GetRelations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		r.relations, r.relationsLoaded = relations, true
+	}
+	return relations, nil
+}
+
+// boosts returns every stored boost, read once per rerank so that boosts set
+// or expired elsewhere apply from the next request.
+func (f *Service[T]) boosts(ctx context.Context) ([]model.Boost, error) {
+	r := requestFrom(ctx)
+	if r != nil && r.boostsLoaded {
+		return r.boosts, nil
+	}
+	boosts, err := f.store.GetBoosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		r.boosts, r.boostsLoaded = boosts, true
+	}
+	return boosts, nil
+}
+
+// coldstartPicks returns up to 5 coldstart feed ids, picked once per rerank,
+// and the audience they are for. The ids are COLD_START_IDS_KEY when set
+// (already merged across audiences and filtered for watched feeds), the
+// default feed_coldstart table otherwise.
+func (f *Service[T]) coldstartPicks(ctx context.Context) ([]string, string, error) {
+	r := requestFrom(ctx)
+	if r != nil && r.coldstartPicked {
+		return r.coldstart, r.audience, nil
+	}
+
+	var idList []string
+	audience, _ := ctx.Value(model.COLD_START_AUDIENCE_KEY).(string)
+	if ids, ok := ctx.Value(model.COLD_START_IDS_KEY).([]string); ok && len(ids) > 0 {
+		idList = slices.Clone(ids)
+	} else {
+		audience = model.ColdstartAudienceDefault
+		positions, err := f.store.GetColdstart(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, p := range positions {
+			idList = append(idList, p.FeedId)
+		}
+	}
+
+	// Select at most 5 coldstart feed IDs
+	if len(idList) > 5 {
+		rand.Shuffle(len(idList), func(i, j int) {
+			idList[i], idList[j] = idList[j], idList[i]
+		})
+		idList = idList[:5]
+	}
+
+	if r != nil {
+		r.coldstart, r.audience, r.coldstartPicked = idList, audience, true
+	}
+	return idList, audience, nil
+}
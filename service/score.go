@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+// WithScoring sets how ScoreStage derives the score feeds are ranked by.
+func WithScoring(scoring model.Scoring) Option {
+	return func(o *options) {
+		o.scoring = scoring
+	}
+}
+
+// ScoreStage sorts the feeds by descending adjusted score: Score() multiplied
+// by the freshness decay of Timestamped data (see WithScoring), the boost of
+// Boostable data, and the stored boosts of the feed and of its type active at
+// model.Now. Ties are broken like in SortStage. Without any of them it sorts
+// like SortStage.
+func (f *Service[T]) ScoreStage() Reranker[T] {
+	return RerankerFunc[T](func(ctx context.Context, feeds model.Feeds[T]) (model.Feeds[T], error) {
+		scores, err := f.adjustedScores(ctx, feeds)
+		if err != nil {
+			return nil, err
+		}
+		order := make([]int, len(feeds))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			a, b := order[i], order[j]
+			if scores[a] != scores[b] {
+				return scores[a] > scores[b]
+			}
+			return model.BreakTie(ctx, f.tieBreak, feeds[a].Data, feeds[b].Data) < 0
+		})
+		sorted := make(model.Feeds[T], len(feeds))
+		for i, j := range order {
+			sorted[i] = feeds[j]
+		}
+		ranked(tracerFrom(ctx), sorted, func(i int) float64 { return scores[order[i]] })
+		return sorted, nil
+	})
+}
+
+// adjustedScores returns the adjusted score of every feed, by index.
+func (f *Service[T]) adjustedScores(ctx context.Context, feeds model.Feeds[T]) ([]float64, error) {
+	boosts, err := f.boosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := model.Now(ctx)
+	feedBoosts := make(map[string]float64)
+	typeBoosts := make(map[model.FeedType]float64)
+	for _, boost := range boosts {
+		if !boost.Active(now) {
+			continue
+		}
+		if boost.FeedId != "" {
+			feedBoosts[boost.FeedId] = boost.Factor
+		} else {
+			typeBoosts[boost.FeedType] = boost.Factor
+		}
+	}
+
+	scores := make([]float64, len(feeds))
+	for i, feed := range feeds {
+		score := feed.Data.Score()
+		if timestamped, ok := any(feed.Data).(model.Timestamped); ok {
+			score *= f.scoring.Decay(timestamped.GetCreatedAt(), now)
+		}
+		if boostable, ok := any(feed.Data).(model.Boostable); ok {
+			score *= boostable.GetBoost()
+		}
+		if factor, ok := feedBoosts[feed.ID]; ok {
+			score *= factor
+		}
+		if factor, ok := typeBoosts[feed.Type]; ok {
+			score *= factor
+		}
+		scores[i] = score
+	}
+	return scores, nil
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+type freshPost struct {
+	MockPost
+	createdAt time.Time
+	boost     float64
+}
+
+func (p freshPost) GetCreatedAt() time.Time {
+	return p.createdAt
+}
+
+func (p freshPost) GetBoost() float64 {
+	return p.boost
+}
+
+func TestGetFeeds_Scoring(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	ctx := context.WithValue(context.Background(), model.NOW_KEY, now)
+	expired := now.Add(-time.Hour)
+	post := func(id string, feedType model.FeedType, score float64, age time.Duration, boost float64) freshPost {
+		return freshPost{MockPost: MockPost{id: id, feedType: feedType, score: score}, createdAt: now.Add(-age), boost: boost}
+	}
+
+	tests := []struct {
+		name     string
+		scoring  model.Scoring
+		boosts   []model.Boost
+		data     []freshPost
+		expected []string
+	}{
+		{
+			name: "scores only",
+			data: []freshPost{
+				post("old", model.TypePost, 100, 72*time.Hour, 1),
+				post("new", model.TypePost, 30, 0, 1),
+			},
+			expected: []string{"old", "new"},
+		},
+		{
+			name:    "freshness decay",
+			scoring: model.Scoring{HalfLife: 24 * time.Hour},
+			data: []freshPost{
+				post("old", model.TypePost, 100, 72*time.Hour, 1), // 12.5
+				post("new", model.TypePost, 30, 0, 1),
+			},
+			expected: []string{"new", "old"},
+		},
+		{
+			name: "data boost",
+			data: []freshPost{
+				post("post1", model.TypePost, 100, 0, 1),
+				post("post2", model.TypePost, 60, 0, 2),
+			},
+			expected: []string{"post2", "post1"},
+		},
+		{
+			name:   "feed and type boosts",
+			boosts: []model.Boost{{FeedId: "post3", Factor: 3}, {FeedType: model.TypeChat, Factor: 0.1}},
+			data: []freshPost{
+				post("chat1", model.TypeChat, 100, 0, 1), // 10
+				post("post2", model.TypePost, 50, 0, 1),
+				post("post3", model.TypePost, 20, 0, 1), // 60
+			},
+			expected: []string{"post3", "post2", "chat1"},
+		},
+		{
+			name:   "expired boosts do not apply",
+			boosts: []model.Boost{{FeedId: "post2", Factor: 10, ExpiresAt: &expired}},
+			data: []freshPost{
+				post("post1", model.TypePost, 100, 0, 1),
+				post("post2", model.TypePost, 50, 0, 1),
+			},
+			expected: []string{"post1", "post2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewFeed[freshPost](&mockStore{boosts: tt.boosts}, WithScoring(tt.scoring))
+
+			feeds, err := svc.GetFeeds(ctx, tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, feed := range feeds {
+				got = append(got, feed.ID)
+			}
+			if !equalIDs(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("boosts are evaluated at NOW_KEY", func(t *testing.T) {
+		expires := now.Add(48 * time.Hour)
+		svc := NewFeed[freshPost](&mockStore{boosts: []model.Boost{{FeedId: "post2", Factor: 10, ExpiresAt: &expires}}})
+		data := []freshPost{
+			post("post1", model.TypePost, 100, 0, 1),
+			post("post2", model.TypePost, 50, 0, 1),
+		}
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if feeds[0].ID != "post2" {
+			t.Errorf("expected the boosted post first, got %v", feeds[0].ID)
+		}
+
+		later := context.WithValue(ctx, model.NOW_KEY, expires)
+		feeds, err = svc.GetFeeds(later, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if feeds[0].ID != "post1" {
+			t.Errorf("expected the boost to have expired, got %v first", feeds[0].ID)
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		svc := NewFeed[freshPost](&mockStore{boostsErr: errors.New("database error")})
+		if _, err := svc.GetFeeds(ctx, []freshPost{post("post1", model.TypePost, 1, 0, 1)}); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+}
+
+func TestUpdateBoosts(t *testing.T) {
+	ctx := context.WithValue(context.Background(), model.USER_ID_KEY, "user1")
+	data := []MockPost{
+		{id: "post1", feedType: model.TypePost, score: 90},
+		{id: "post2", feedType: model.TypePost, score: 80},
+		{id: "post3", feedType: model.TypePost, score: 70},
+	}
+
+	store := &mockStore{}
+	svc := NewFeed[MockPost](store, WithPageCache(NewLRUPageCache(10, 0)))
+
+	_, cursor, err := svc.GetFeedsPage(ctx, data, "", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := svc.SetBoost(ctx, model.Boost{FeedId: "post3", Factor: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := svc.GetFeedsPage(ctx, nil, cursor, 2); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected boosting to invalidate cursors, got %v", err)
+	}
+
+	feeds, err := svc.GetFeeds(ctx, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if feeds[0].ID != "post3" {
+		t.Errorf("expected the boosted post first, got %v", feeds[0].ID)
+	}
+	if store.boostsCalls != 2 {
+		t.Errorf("expected boosts read once per request, got %d reads", store.boostsCalls)
+	}
+
+	// boosts set by another process apply from the next request
+	store.boosts = []model.Boost{{FeedId: "post2", Factor: 10}}
+	feeds, err = svc.GetFeeds(ctx, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if feeds[0].ID != "post2" {
+		t.Errorf("expected the externally boosted post first, got %v", feeds[0].ID)
+	}
+
+	store.boostsErr = errors.New("database error")
+	if err := svc.DeleteBoost(ctx, "post3", ""); err == nil {
+		t.Fatal("expected error but got none")
+	}
+}
+
+func TestGetFeeds_TieBreakers(t *testing.T) {
+	ctx := context.WithValue(context.Background(), model.USER_ID_KEY, "user1")
+	data := []MockPost{
+		{id: "post1", feedType: model.TypePost, score: 10},
+		{id: "post2", feedType: model.TypePost, score: 10},
+		{id: "post3", feedType: model.TypePost, score: 10},
+		{id: "post4", feedType: model.TypePost, score: 10},
+		{id: "top", feedType: model.TypePost, score: 20},
+	}
+	reversed := make([]MockPost, len(data))
+	for i := range data {
+		reversed[len(data)-1-i] = data[i]
+	}
+
+	for _, sortStage := range []string{"ScoreStage", "SortStage"} {
+		t.Run(sortStage, func(t *testing.T) {
+			svc := NewFeed[MockPost](&mockStore{}, WithTieBreakers(model.TieBreakUserHash))
+			if sortStage == "SortStage" {
+				svc.SetPipeline(svc.SortStage(), svc.DedupStage(), svc.PinStage(), svc.ColdstartStage())
+			}
+
+			first, err := svc.GetFeeds(ctx, data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			second, err := svc.GetFeeds(ctx, reversed)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !equalIDs(pageIDs(first), pageIDs(second)) {
+				t.Errorf("expected the same order whatever the data order, got %v and %v", pageIDs(first), pageIDs(second))
+			}
+			if first[0].ID != "top" {
+				t.Errorf("expected the highest score first, got %v", first[0].ID)
+			}
+		})
+	}
+
+	t.Run("without tie breakers ties keep the data order", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{})
+
+		feeds, err := svc.GetFeeds(ctx, reversed)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []string{"top", "post4", "post3", "post2", "post1"}
+		if got := pageIDs(feeds); !equalIDs(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+type tracerKey struct{}
+
+// tracer collects a model.Trace while the pipeline runs. A nil tracer
+// discards everything, so stages record unconditionally.
+type tracer struct {
+	trace   *model.Trace
+	entries map[string]*model.FeedTrace
+	ids     []string // data order
+}
+
+// withTracer starts tracing feeds when the caller set a *model.Trace under
+// model.TRACE_KEY.
+func withTracer[T model.Scorable](ctx context.Context, feeds model.Feeds[T]) (context.Context, *tracer) {
+	trace, _ := ctx.Value(model.TRACE_KEY).(*model.Trace)
+	if trace == nil {
+		return ctx, nil
+	}
+	t := &tracer{trace: trace, entries: make(map[string]*model.FeedTrace, len(feeds))}
+	for i, feed := range feeds {
+		if _, exists := t.entries[feed.ID]; exists {
+			continue
+		}
+		t.entries[feed.ID] = &model.FeedTrace{FeedId: feed.ID, Rank: i, Score: feed.Data.Score(), Position: -1}
+		t.ids = append(t.ids, feed.ID)
+	}
+	return context.WithValue(ctx, tracerKey{}, t), t
+}
+
+func tracerFrom(ctx context.Context) *tracer {
+	t, _ := ctx.Value(tracerKey{}).(*tracer)
+	return t
+}
+
+// ranked records the rank and score of every feed once sorted.
+func ranked[T model.Scorable](t *tracer, feeds model.Feeds[T], score func(i int) float64) {
+	if t == nil {
+		return
+	}
+	seen := make(map[string]bool, len(feeds))
+	for i, feed := range feeds {
+		if entry, ok := t.entries[feed.ID]; ok && !seen[feed.ID] {
+			entry.Rank, entry.Score = i, score(i)
+			seen[feed.ID] = true
+		}
+	}
+}
+
+// removed records why feedID was dropped, unless a reason was recorded
+// already.
+func (t *tracer) removed(feedID, reason string) {
+	if t == nil {
+		return
+	}
+	if entry, ok := t.entries[feedID]; ok && entry.RemovedBy == "" {
+		entry.RemovedBy = reason
+	}
+}
+
+func (t *tracer) pinned(feedID string, pin model.Policy) {
+	if t == nil {
+		return
+	}
+	if entry, ok := t.entries[feedID]; ok {
+		entry.Pin = &pin
+	}
+}
+
+func (t *tracer) servedFor(feedID, holderID string) {
+	if t == nil {
+		return
+	}
+	if entry, ok := t.entries[feedID]; ok {
+		entry.HolderId = holderID
+	}
+}
+
+func (t *tracer) coldstart(feedID, audience string) {
+	if t == nil {
+		return
+	}
+	if entry, ok := t.entries[feedID]; ok {
+		entry.Coldstart, entry.Audience = true, audience
+	}
+}
+
+// backfilled records a feed pulled from the backfill source.
+func backfilled[T model.Scorable](t *tracer, feed model.Feed[T]) {
+	if t == nil {
+		return
+	}
+	if _, exists := t.entries[feed.ID]; exists {
+		return
+	}
+	t.entries[feed.ID] = &model.FeedTrace{FeedId: feed.ID, Rank: -1, Score: feed.Data.Score(), Position: -1, Backfilled: true}
+	t.ids = append(t.ids, feed.ID)
+}
+
+// stageRemoved records the feeds stage i dropped.
+func stageRemoved[T model.Scorable](t *tracer, i int, before, after model.Feeds[T]) {
+	if t == nil {
+		return
+	}
+	kept := make(map[string]bool, len(after))
+	for _, feed := range after {
+		kept[feed.ID] = true
+	}
+	for _, feed := range before {
+		if !kept[feed.ID] {
+			t.removed(feed.ID, fmt.Sprintf("stage %d", i))
+		}
+	}
+}
+
+// finish records where the feeds are served and writes the trace out.
+func finish[T model.Scorable](t *tracer, feeds model.Feeds[T]) {
+	if t == nil {
+		return
+	}
+	out := make([]model.FeedTrace, 0, len(t.ids))
+	served := make(map[string]bool, len(feeds))
+	inserted := 0
+	for i, feed := range feeds {
+		entry, ok := t.entries[feed.ID]
+		if !ok || served[feed.ID] {
+			continue
+		}
+		served[feed.ID] = true
+		entry.Position, entry.RemovedBy = i, ""
+		if entry.Pin != nil || entry.Coldstart {
+			inserted++
+		} else {
+			entry.ShiftedBy = inserted
+		}
+		out = append(out, *entry)
+	}
+	for _, id := range t.ids {
+		if !served[id] {
+			out = append(out, *t.entries[id])
+		}
+	}
+	t.trace.Feeds = out
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/A-pen-app/feed-sdk/model"
+	"github.com/lib/pq"
+)
+
+func TestGetFeeds_Trace(t *testing.T) {
+	data := []MockPost{
+		{id: "member1", feedType: model.TypePost, score: 90},
+		{id: "member2", feedType: model.TypePost, score: 80},
+		{id: "post1", feedType: model.TypePost, score: 50},
+		{id: "post2", feedType: model.TypePost, score: 70},
+		{id: "banner", feedType: model.TypeBanners, score: 1},
+	}
+
+	t.Run("pins, relations and removals", func(t *testing.T) {
+		store := &mockStore{
+			policies: []model.Policy{
+				{FeedId: "banner", FeedType: model.TypeBanners, Position: 0},
+				{FeedId: "holder", FeedType: model.TypePosts, Position: 2},
+			},
+			relations: []model.Relation{
+				{FeedId: "member1", RelatedFeedId: "holder", Policies: pq.StringArray{"exposure:100"}, Weight: 1},
+				{FeedId: "member2", RelatedFeedId: "holder", Weight: 1},
+			},
+		}
+		svc := NewFeed[MockPost](store, WithPolicyResolver(&mockPolicyResolver{
+			viewCounts: map[string]int64{"member1": 200},
+		}))
+		trace := &model.Trace{}
+		ctx := context.WithValue(context.Background(), model.TRACE_KEY, trace)
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []string{"banner", "post2", "member2", "post1"}
+		if got := pageIDs(feeds); !equalIDs(got, expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+
+		var traced []string
+		for _, feed := range trace.Feeds {
+			traced = append(traced, feed.FeedId)
+		}
+		if expected := []string{"banner", "post2", "member2", "post1", "member1"}; !equalIDs(traced, expected) {
+			t.Fatalf("expected traces for %v, got %v", expected, traced)
+		}
+
+		banner := trace.Feed("banner")
+		if banner.Pin == nil || banner.Pin.Position != 0 || banner.Position != 0 || banner.Rank != 4 {
+			t.Errorf("unexpected banner trace %+v", banner)
+		}
+		member2 := trace.Feed("member2")
+		if member2.Pin == nil || member2.Pin.Position != 2 || member2.HolderId != "holder" || member2.Position != 2 || member2.Rank != 1 {
+			t.Errorf("unexpected member2 trace %+v", member2)
+		}
+		post2 := trace.Feed("post2")
+		if post2.Pin != nil || post2.Rank != 2 || post2.Score != 70 || post2.Position != 1 || post2.ShiftedBy != 1 {
+			t.Errorf("unexpected post2 trace %+v", post2)
+		}
+		post1 := trace.Feed("post1")
+		if post1.Position != 3 || post1.ShiftedBy != 2 {
+			t.Errorf("unexpected post1 trace %+v", post1)
+		}
+		member1 := trace.Feed("member1")
+		if member1.Position != -1 || member1.RemovedBy != "exposure:100" || member1.Rank != 0 {
+			t.Errorf("unexpected member1 trace %+v", member1)
+		}
+	})
+
+	t.Run("coldstart", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{})
+		trace := &model.Trace{}
+		ctx := context.WithValue(context.Background(), model.TRACE_KEY, trace)
+		ctx = context.WithValue(ctx, model.COLD_START_KEY, true)
+		ctx = context.WithValue(ctx, model.COLD_START_IDS_KEY, []string{"post1"})
+		ctx = context.WithValue(ctx, model.COLD_START_AUDIENCE_KEY, model.ColdstartAudienceStudent)
+
+		feeds, err := svc.GetFeeds(ctx, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		post1 := trace.Feed("post1")
+		if !post1.Coldstart || post1.Audience != model.ColdstartAudienceStudent || feeds[post1.Position].ID != "post1" {
+			t.Errorf("unexpected post1 trace %+v", post1)
+		}
+		for _, feed := range trace.Feeds {
+			expected := 0
+			if feed.FeedId != "post1" && feed.Position > post1.Position {
+				expected = 1
+			}
+			if feed.FeedId != "post1" && feed.ShiftedBy != expected {
+				t.Errorf("expected %v to be shifted by %d, got %d", feed.FeedId, expected, feed.ShiftedBy)
+			}
+		}
+	})
+
+	t.Run("coldstart table audience", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{
+			policies: []model.Policy{{FeedId: "post2", FeedType: model.TypePost}},
+		})
+		trace := &model.Trace{}
+		ctx := context.WithValue(context.Background(), model.TRACE_KEY, trace)
+		ctx = context.WithValue(ctx, model.COLD_START_KEY, true)
+
+		if _, err := svc.GetFeeds(ctx, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if post2 := trace.Feed("post2"); !post2.Coldstart || post2.Audience != model.ColdstartAudienceDefault {
+			t.Errorf("unexpected post2 trace %+v", post2)
+		}
+	})
+
+	t.Run("custom stages removing feeds", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{})
+		drop := RerankerFunc[MockPost](func(ctx context.Context, feeds model.Feeds[MockPost]) (model.Feeds[MockPost], error) {
+			return feeds[1:], nil
+		})
+		svc.SetPipeline(svc.SortStage(), drop)
+		trace := &model.Trace{}
+		ctx := context.WithValue(context.Background(), model.TRACE_KEY, trace)
+
+		if _, err := svc.GetFeeds(ctx, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if member1 := trace.Feed("member1"); member1.RemovedBy != "stage 1" || member1.Position != -1 {
+			t.Errorf("unexpected member1 trace %+v", member1)
+		}
+	})
+
+	t.Run("trace is replaced on every call", func(t *testing.T) {
+		svc := NewFeed[MockPost](&mockStore{})
+		trace := &model.Trace{Feeds: []model.FeedTrace{{FeedId: "stale"}}}
+		ctx := context.WithValue(context.Background(), model.TRACE_KEY, trace)
+
+		if _, err := svc.GetFeeds(ctx, data[:2]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(trace.Feeds) != 2 || trace.Feed("stale") != nil {
+			t.Errorf("unexpected trace %+v", trace.Feeds)
+		}
+	})
+}
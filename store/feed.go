@@ -2,9 +2,14 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/A-pen-app/feed-sdk/model"
 	"github.com/jmoiron/sqlx"
@@ -101,11 +106,50 @@ BEGIN
 END $$;
 `
 
+// addPositionRangeColumnsSQL adds range pins (see model.Policy): max_position,
+// min_spacing and anchor. The unique position constraint only holds for exact
+// pins now, per anchor, since range pins may overlap and are spread out at
+// request time.
+const addPositionRangeColumnsSQL = `
+DO $$
+BEGIN
+	ALTER TABLE feed
+		ADD COLUMN IF NOT EXISTS max_position integer,
+		ADD COLUMN IF NOT EXISTS min_spacing integer NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS anchor character varying(10) NOT NULL DEFAULT 'start';
+
+	IF NOT EXISTS (
+		SELECT 1 FROM pg_constraint
+		WHERE conrelid = 'feed'::regclass AND conname = 'feed_position_range_check'
+	) THEN
+		ALTER TABLE feed ADD CONSTRAINT feed_position_range_check CHECK (
+			(max_position IS NULL OR max_position >= position)
+			AND min_spacing >= 0
+			AND anchor IN ('start', 'end')
+		);
+	END IF;
+
+	ALTER TABLE feed DROP CONSTRAINT IF EXISTS feed_position_position1_key;
+	CREATE UNIQUE INDEX IF NOT EXISTS feed_fixed_position_key
+		ON feed (anchor, position) WHERE max_position IS NULL;
+END $$;
+`
+
+// addPinColdstartColumnSQL adds the flag that makes a pin apply to coldstart
+// feeds too. Existing pins keep staying out of them.
+const addPinColdstartColumnSQL = `
+ALTER TABLE feed
+	ADD COLUMN IF NOT EXISTS coldstart boolean NOT NULL DEFAULT false
+`
+
 // addPolicyFormatConstraintSQL creates a trigger function and trigger to validate policy format.
-// Policies must be colon-separated with a valid policy type prefix.
-// To update this constraint when adding new policy types:
-//  1. Add the new policy type to the regex pattern in the function
-//  2. Run the migration (it will replace the function)
+// Policies must be colon-separated with a valid policy type prefix, or an
+// "expr:" boolean expression (see model.PolicyExpr) whose every token is an
+// operator, a parenthesis or such a policy. Grouping is checked in Go only.
+// The accepted prefixes are filled in by policyFormatConstraintSQL from the
+// kinds registered in model at migration time, so a new policy type (built-in
+// or registered by the host) only needs NewFeed to run again. Kinds the
+// installed trigger already accepts are kept (see triggerPolicyKinds).
 const addPolicyFormatConstraintSQL = `
 DO $$
 BEGIN
@@ -114,10 +158,21 @@ BEGIN
 	RETURNS TRIGGER AS $func$
 	DECLARE
 		p TEXT;
+		token TEXT;
+		atom_pattern CONSTANT TEXT := '^({{policy_kinds}}):[a-z0-9:._-]+$';
 	BEGIN
 		IF NEW.policies IS NOT NULL AND array_length(NEW.policies, 1) > 0 THEN
 			FOREACH p IN ARRAY NEW.policies LOOP
-				IF p !~ '^(exposure|inexpose|unexpose|istarget|istheone):[a-z0-9:_-]+$' THEN
+				IF p ~ '^expr:' THEN
+					IF p !~ '^expr:[a-z0-9:._() -]+$' THEN
+						RAISE EXCEPTION 'Invalid policy expression: %', p;
+					END IF;
+					FOREACH token IN ARRAY regexp_split_to_array(btrim(regexp_replace(substr(p, 6), '([()])', ' \1 ', 'g')), '\s+') LOOP
+						IF token NOT IN ('and', 'or', 'not', '(', ')') AND token !~ atom_pattern THEN
+							RAISE EXCEPTION 'Invalid policy expression: %. Unexpected %', p, token;
+						END IF;
+					END LOOP;
+				ELSIF p !~ atom_pattern THEN
 					RAISE EXCEPTION 'Invalid policy format: %. Must match pattern {policy_type}:{params}', p;
 				END IF;
 			END LOOP;
@@ -137,6 +192,45 @@ BEGIN
 END $$;
 `
 
+// policyFormatConstraintSQL renders addPolicyFormatConstraintSQL for the
+// given policy kinds. Kind names are restricted to [a-z0-9_] by
+// model.RegisterPolicyKind, so they are safe to interpolate.
+func policyFormatConstraintSQL(kinds []string) string {
+	return strings.Replace(addPolicyFormatConstraintSQL, "'^({{policy_kinds}}):", policyKindsPattern(kinds), 1)
+}
+
+// policyKindsPattern is the start of the trigger's policy pattern for the
+// given policy kinds.
+func policyKindsPattern(kinds []string) string {
+	return "'^(" + strings.Join(kinds, "|") + "):"
+}
+
+// selectPolicyTriggerSQL reads the source of the installed policy format
+// trigger function.
+const selectPolicyTriggerSQL = `SELECT prosrc FROM pg_proc WHERE proname = 'validate_policies_format'`
+
+// installedKindsPattern finds the kinds in the source of a policy format
+// trigger, of this version or of the ones with a fixed list.
+var installedKindsPattern = regexp.MustCompile(`'\^\(([a-z0-9_|]+)\):`)
+
+// triggerPolicyKinds returns the kinds the policy format trigger is installed
+// with: those registered in model and those the installed trigger, described
+// by source, already accepts. The trigger is shared by every process using
+// the database, so a process that did not register the host's custom kinds
+// must not drop them, or every later write to rows carrying them would fail.
+func triggerPolicyKinds(source string) []string {
+	kinds := model.PolicyKindNames()
+	if match := installedKindsPattern.FindStringSubmatch(source); match != nil {
+		for _, kind := range strings.Split(match[1], "|") {
+			if !slices.Contains(kinds, kind) {
+				kinds = append(kinds, kind)
+			}
+		}
+		slices.Sort(kinds)
+	}
+	return kinds
+}
+
 // widenPolicyColumnsSQL relaxes every policy column to text[] on databases
 // created before that became the default: feed.policies,
 // feed_changelog.old_policies, feed_changelog.new_policies and
@@ -215,7 +309,11 @@ func NewFeed(db *sqlx.DB) *store {
 		panic("failed to create feed_coldstart table: " + err.Error())
 	}
 
-	if _, err := db.Exec(addPolicyFormatConstraintSQL); err != nil {
+	var source string
+	if err := db.Get(&source, selectPolicyTriggerSQL); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		panic("failed to read policy format constraint: " + err.Error())
+	}
+	if _, err := db.Exec(policyFormatConstraintSQL(triggerPolicyKinds(source))); err != nil {
 		panic("failed to add policy format constraint: " + err.Error())
 	}
 
@@ -223,6 +321,14 @@ func NewFeed(db *sqlx.DB) *store {
 		panic("failed to create feed_relation table: " + err.Error())
 	}
 
+	if _, err := db.Exec(addRelationPolicyFormatConstraintSQL); err != nil {
+		panic("failed to add relation policy format constraint: " + err.Error())
+	}
+
+	if _, err := db.Exec(addRelationOrderColumnsSQL); err != nil {
+		panic("failed to add feed_relation order columns: " + err.Error())
+	}
+
 	if _, err := db.Exec(createFeedChangelogTableSQL); err != nil {
 		panic("failed to create feed_changelog table: " + err.Error())
 	}
@@ -235,6 +341,18 @@ func NewFeed(db *sqlx.DB) *store {
 		panic("failed to create feed_changelog trigger: " + err.Error())
 	}
 
+	if _, err := db.Exec(addPositionRangeColumnsSQL); err != nil {
+		panic("failed to add position range columns: " + err.Error())
+	}
+
+	if _, err := db.Exec(createFeedBoostTableSQL); err != nil {
+		panic("failed to create feed_boost table: " + err.Error())
+	}
+
+	if _, err := db.Exec(addPinColdstartColumnSQL); err != nil {
+		panic("failed to add pin coldstart column: " + err.Error())
+	}
+
 	return &store{
 		db: db,
 	}
@@ -254,11 +372,16 @@ func (f *store) GetPolicies(ctx context.Context) ([]model.Policy, error) {
 			feed.feed_id,
 			feed.feed_type,
 			feed.position,
-			feed.policies
+			feed.policies,
+			feed.max_position,
+			feed.min_spacing,
+			feed.anchor,
+			feed.coldstart
 		FROM
 			feed
 		ORDER BY
-			feed.position ASC
+			feed.position ASC,
+			feed.feed_id ASC
 		`,
 	); err != nil {
 		return nil, err
@@ -267,6 +390,35 @@ func (f *store) GetPolicies(ctx context.Context) ([]model.Policy, error) {
 	return orders, nil
 }
 
+// GetPolicy returns the policies a single feed is served under: its pin in feed
+// or, when it is only queued behind a slot holder, its feed_relation row with
+// the holder's type and position. A pin wins over a relation row. Returns
+// sql.ErrNoRows when the feed is neither.
+func (f *store) GetPolicy(ctx context.Context, feedID string) (*model.Policy, error) {
+	policy := model.Policy{}
+	if err := f.db.GetContext(ctx, &policy,
+		`
+		SELECT feed_id, feed_type, position, policies
+		FROM (
+			SELECT feed.feed_id, feed.feed_type, feed.position, feed.policies, 0 AS source
+			FROM feed
+			WHERE feed.feed_id = $1
+			UNION ALL
+			SELECT feed_relation.feed_id, feed.feed_type, feed.position, feed_relation.policies, 1 AS source
+			FROM feed_relation
+			JOIN feed ON feed.feed_id = feed_relation.related_feed_id
+			WHERE feed_relation.feed_id = $1
+		) candidates
+		ORDER BY source ASC
+		LIMIT 1
+		`,
+		feedID,
+	); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
 func (f *store) GetColdstart(ctx context.Context) ([]model.Policy, error) {
 	return f.GetColdstartByAudience(ctx, model.ColdstartAudienceDefault)
 }
@@ -339,7 +491,7 @@ func (f *store) GetColdstartBySpecialty(ctx context.Context, specialties []strin
 }
 
 func (f *store) PatchFeed(ctx context.Context, id string, feed_type model.FeedType, position int) error {
-	_, err := f.db.NamedExec(
+	result, err := f.db.NamedExec(
 		`
 		INSERT INTO 
 			feed 
@@ -359,13 +511,132 @@ func (f *store) PatchFeed(ctx context.Context, id string, feed_type model.FeedTy
 		DO UPDATE SET 
 			feed_type = :feed_type,
 			position = :position
+		WHERE
+			feed.max_position IS NULL OR feed.max_position >= :position
 		`,
 		map[string]interface{}{
 			"feed_id":   id,
 			"feed_type": feed_type,
 			"position":  position,
 		})
-	return err
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: position %d is past the max position of range pin %s", ErrInvalidPositionRange, position, id)
+	}
+	return nil
+}
+
+// ErrInvalidPositionRange is returned when a range pin would end before its
+// position, or be spaced by a negative number of feeds.
+var ErrInvalidPositionRange = errors.New("invalid position range")
+
+// SetPositionRange makes the pinned feed id a range pin landing anywhere from
+// its position to maxPosition, or an exact pin again when maxPosition is nil,
+// and sets its spacing and anchor. Returns sql.ErrNoRows when id is not pinned
+// and ErrInvalidPositionRange when maxPosition is before its position.
+func (f *store) SetPositionRange(ctx context.Context, id string, maxPosition *int, minSpacing int, anchor model.Anchor) error {
+	if minSpacing < 0 {
+		return fmt.Errorf("%w: min spacing %d", ErrInvalidPositionRange, minSpacing)
+	}
+	if !anchor.Valid() {
+		return fmt.Errorf("invalid anchor %q", anchor)
+	}
+	if anchor == "" {
+		anchor = model.AnchorStart
+	}
+
+	tx, err := f.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var position int
+	if err := tx.GetContext(ctx, &position, `SELECT position FROM feed WHERE feed_id = $1 FOR UPDATE`, id); err != nil {
+		return err
+	}
+	if maxPosition != nil && *maxPosition < position {
+		return fmt.Errorf("%w: max position %d is before position %d", ErrInvalidPositionRange, *maxPosition, position)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE feed SET max_position = $1, min_spacing = $2, anchor = $3 WHERE feed_id = $4`,
+		maxPosition, minSpacing, anchor, id,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetPinColdstart sets whether the pinned feed id applies to coldstart feeds
+// too. Returns sql.ErrNoRows when id is not pinned.
+func (f *store) SetPinColdstart(ctx context.Context, id string, coldstart bool) error {
+	return f.execOne(ctx, `UPDATE feed SET coldstart = $1 WHERE feed_id = $2`, coldstart, id)
+}
+
+// Policy array updates, with the policy as $1. Adding a policy the row
+// already carries is a no-op.
+const (
+	setPoliciesExpr  = `$1`
+	addPolicyExpr    = `CASE WHEN $1::text = ANY(policies) THEN policies ELSE array_append(policies, $1::text) END`
+	removePolicyExpr = `array_remove(policies, $1::text)`
+)
+
+// SetPolicies replaces the policies of the pinned feed id. Returns
+// sql.ErrNoRows when id is not pinned.
+func (f *store) SetPolicies(ctx context.Context, id string, policies pq.StringArray) error {
+	if err := validatePolicies(policies); err != nil {
+		return err
+	}
+	if policies == nil {
+		policies = pq.StringArray{}
+	}
+	return f.updatePolicies(ctx, "feed", setPoliciesExpr, policies, "feed_id = $2", id)
+}
+
+// AddPolicy appends policy to the pinned feed id unless it is already there.
+// Returns sql.ErrNoRows when id is not pinned.
+func (f *store) AddPolicy(ctx context.Context, id, policy string) error {
+	if err := validatePolicies([]string{policy}); err != nil {
+		return err
+	}
+	return f.updatePolicies(ctx, "feed", addPolicyExpr, policy, "feed_id = $2", id)
+}
+
+// RemovePolicy removes every occurrence of policy from the pinned feed id.
+// Returns sql.ErrNoRows when id is not pinned.
+func (f *store) RemovePolicy(ctx context.Context, id, policy string) error {
+	return f.updatePolicies(ctx, "feed", removePolicyExpr, policy, "feed_id = $2", id)
+}
+
+// updatePolicies sets policies to expr on the row of table matched by where.
+// table, expr and where are never user input.
+func (f *store) updatePolicies(ctx context.Context, table, expr string, policy any, where string, keys ...any) error {
+	return f.execOne(ctx,
+		fmt.Sprintf(`UPDATE %s SET policies = %s WHERE %s`, table, expr, where),
+		append([]any{policy}, keys...)...)
+}
+
+// execOne runs a statement that must affect a row, and returns sql.ErrNoRows
+// when it affects none.
+func (f *store) execOne(ctx context.Context, query string, args ...any) error {
+	result, err := f.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (f *store) DeleteFeed(ctx context.Context, id string) error {
@@ -376,12 +647,9 @@ func (f *store) DeleteFeed(ctx context.Context, id string) error {
 	defer tx.Rollback()
 
 	// Get the feed to be deleted
-	var deletedFeed struct {
-		FeedType string `db:"feed_type"`
-		Position int    `db:"position"`
-	}
+	var deletedFeed promotedSlot
 	err = tx.GetContext(ctx, &deletedFeed,
-		`SELECT feed_type, position FROM feed WHERE feed_id = $1 FOR UPDATE`, id)
+		`SELECT `+promotedSlotColumns+` FROM feed WHERE feed_id = $1 FOR UPDATE`, id)
 	if err != nil {
 		// Feed not found or error — attempt simple delete
 		if _, err := tx.ExecContext(ctx, `DELETE FROM feed WHERE feed_id = $1`, id); err != nil {
@@ -391,20 +659,19 @@ func (f *store) DeleteFeed(ctx context.Context, id string) error {
 	}
 
 	// Only promote a replacement for 'posts' type
-	if model.FeedType(deletedFeed.FeedType) != model.TypePosts {
+	if deletedFeed.FeedType != model.TypePosts {
 		if _, err := tx.ExecContext(ctx, `DELETE FROM feed WHERE feed_id = $1`, id); err != nil {
 			return err
 		}
 		return tx.Commit()
 	}
 
-	// Look for a replacement candidate in feed_relation where related_feed_id = source_id
+	// Look for the next member in feed_relation where related_feed_id = source_id
 	var replacement struct {
 		FeedID   string         `db:"feed_id"`
 		Policies pq.StringArray `db:"policies"`
 	}
-	err = tx.GetContext(ctx, &replacement,
-		`SELECT feed_id, policies FROM feed_relation WHERE related_feed_id = $1 LIMIT 1`, id)
+	err = tx.GetContext(ctx, &replacement, selectPromotionCandidateSQL, id)
 	if err != nil {
 		// No replacement available, simple delete
 		if _, err := tx.ExecContext(ctx, `DELETE FROM feed WHERE feed_id = $1`, id); err != nil {
@@ -433,15 +700,10 @@ func (f *store) DeleteFeed(ctx context.Context, id string) error {
 		return err
 	}
 
-	// 4. Insert the replacement feed at the same position
-	if _, err := tx.ExecContext(ctx,
-		`INSERT INTO feed (feed_id, feed_type, position, policies)
-		 VALUES ($1, $2, $3, $4)
-		 ON CONFLICT (feed_id) DO UPDATE SET
-			 feed_type = EXCLUDED.feed_type,
-			 position = EXCLUDED.position,
-			 policies = EXCLUDED.policies`,
-		replacement.FeedID, model.TypePosts, deletedFeed.Position, replacement.Policies); err != nil {
+	// 4. Insert the replacement feed in the same slot
+	if _, err := tx.ExecContext(ctx, insertPromotedSQL,
+		replacement.FeedID, model.TypePosts, deletedFeed.Position, replacement.Policies,
+		deletedFeed.MaxPosition, deletedFeed.MinSpacing, deletedFeed.Anchor, deletedFeed.Coldstart); err != nil {
 		return err
 	}
 
@@ -474,7 +736,8 @@ func (f *store) CreateFeedPosition(ctx context.Context, feedID string, feedType
 		FeedType string `db:"feed_type"`
 	}
 	err = tx.GetContext(ctx, &existing,
-		`SELECT feed_id, feed_type FROM feed WHERE position = $1 FOR UPDATE`, position)
+		`SELECT feed_id, feed_type FROM feed WHERE position = $1 AND anchor = $2 AND max_position IS NULL FOR UPDATE`,
+		position, model.AnchorStart)
 	if err != nil {
 		// Position empty — insert directly
 		_, err = tx.NamedExecContext(ctx,
@@ -499,20 +762,53 @@ func (f *store) CreateFeedPosition(ctx context.Context, feedID string, feedType
 	}
 
 	// Existing type is "post" or "posts" — add relation
-	if err := f.AddRelationWithPolicies(ctx, tx, feedID, existing.FeedID, policies); err != nil {
+	if err := f.joinGroup(ctx, tx, feedID, existing.FeedID, existingType, policies); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddGroupMember queues feedID behind the pinned post holderID, whatever the
+// anchor or range of its slot, making it a posts group. Returns sql.ErrNoRows
+// when holderID is not pinned.
+func (f *store) AddGroupMember(ctx context.Context, feedID, holderID string, policies pq.StringArray) error {
+	tx, err := f.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var holderType model.FeedType
+	if err := tx.GetContext(ctx, &holderType,
+		`SELECT feed_type FROM feed WHERE feed_id = $1 FOR UPDATE`, holderID); err != nil {
+		return err
+	}
+	if holderType == model.TypeBanners {
+		return fmt.Errorf("feed %s is a banner", holderID)
+	}
+	if err := f.joinGroup(ctx, tx, feedID, holderID, holderType, policies); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// joinGroup adds feedID to the group of holderID, upgrading a post holder to
+// posts.
+func (f *store) joinGroup(ctx context.Context, tx *sqlx.Tx, feedID, holderID string, holderType model.FeedType, policies pq.StringArray) error {
+	if err := f.AddRelationWithPolicies(ctx, tx, feedID, holderID, policies); err != nil {
 		return err
 	}
 
 	// Upgrade to "posts" if the existing entry is still "post"
-	if existingType == model.TypePost {
+	if holderType == model.TypePost {
 		if _, err := tx.ExecContext(ctx,
 			`UPDATE feed SET feed_type = $1 WHERE feed_id = $2`,
-			model.TypePosts, existing.FeedID); err != nil {
+			model.TypePosts, holderID); err != nil {
 			return err
 		}
 	}
-
-	return tx.Commit()
+	return nil
 }
 
 func (f *store) DeleteFeedPosition(ctx context.Context, feedID string, position int) error {
@@ -523,20 +819,25 @@ func (f *store) DeleteFeedPosition(ctx context.Context, feedID string, position
 	defer tx.Rollback()
 
 	// Check if there is a row matching feed_id AND position
-	var existing struct {
-		FeedID   string `db:"feed_id"`
-		FeedType string `db:"feed_type"`
-	}
+	var existing promotedSlot
 	err = tx.GetContext(ctx, &existing,
-		`SELECT feed_id, feed_type FROM feed WHERE feed_id = $1 AND position = $2 FOR UPDATE`,
+		`SELECT `+promotedSlotColumns+` FROM feed WHERE feed_id = $1 AND position = $2 FOR UPDATE`,
 		feedID, position)
 	if err != nil {
-		// No row matching both feed_id and position — look in feed_relation instead
+		// No row matching both feed_id and position — look in feed_relation
+		// instead, for the group at position feedID is a member of, whatever
+		// its anchor or range
 		var positionHolder struct {
 			FeedID string `db:"feed_id"`
 		}
 		if err := tx.GetContext(ctx, &positionHolder,
-			`SELECT feed_id FROM feed WHERE position = $1 FOR UPDATE`, position); err != nil {
+			`SELECT feed_id FROM feed
+			 WHERE position = $1
+			   AND feed_id IN (SELECT related_feed_id FROM feed_relation WHERE feed_id = $2)
+			 ORDER BY feed_id
+			 LIMIT 1
+			 FOR UPDATE`,
+			position, feedID); err != nil {
 			return fmt.Errorf("no feed found at position %d: %w", position, err)
 		}
 
@@ -550,7 +851,7 @@ func (f *store) DeleteFeedPosition(ctx context.Context, feedID string, position
 	}
 
 	// Row found — check feed_type
-	if model.FeedType(existing.FeedType) != model.TypePosts {
+	if existing.FeedType != model.TypePosts {
 		// Simple delete
 		if _, err := tx.ExecContext(ctx, `DELETE FROM feed WHERE feed_id = $1`, feedID); err != nil {
 			return err
@@ -558,14 +859,12 @@ func (f *store) DeleteFeedPosition(ctx context.Context, feedID string, position
 		return tx.Commit()
 	}
 
-	// feed_type is "posts" — pick a random replacement from feed_relation
+	// feed_type is "posts" — promote the next member from feed_relation
 	var replacement struct {
 		FeedID   string         `db:"feed_id"`
 		Policies pq.StringArray `db:"policies"`
 	}
-	err = tx.GetContext(ctx, &replacement,
-		`SELECT feed_id, policies FROM feed_relation WHERE related_feed_id = $1 ORDER BY RANDOM() LIMIT 1`,
-		feedID)
+	err = tx.GetContext(ctx, &replacement, selectPromotionCandidateSQL, feedID)
 	if err != nil {
 		// No replacement available, simple delete
 		if _, err := tx.ExecContext(ctx, `DELETE FROM feed WHERE feed_id = $1`, feedID); err != nil {
@@ -594,15 +893,10 @@ func (f *store) DeleteFeedPosition(ctx context.Context, feedID string, position
 		return err
 	}
 
-	// 4. Insert the replacement feed at the same position
-	if _, err := tx.ExecContext(ctx,
-		`INSERT INTO feed (feed_id, feed_type, position, policies)
-		 VALUES ($1, $2, $3, $4)
-		 ON CONFLICT (feed_id) DO UPDATE SET
-			 feed_type = EXCLUDED.feed_type,
-			 position = EXCLUDED.position,
-			 policies = EXCLUDED.policies`,
-		replacement.FeedID, model.TypePosts, position, replacement.Policies); err != nil {
+	// 4. Insert the replacement feed in the same slot
+	if _, err := tx.ExecContext(ctx, insertPromotedSQL,
+		replacement.FeedID, model.TypePosts, existing.Position, replacement.Policies,
+		existing.MaxPosition, existing.MinSpacing, existing.Anchor, existing.Coldstart); err != nil {
 		return err
 	}
 
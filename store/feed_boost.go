@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+
+	"github.com/A-pen-app/feed-sdk/model"
+)
+
+// createFeedBoostTableSQL creates the table of editorial boosts (see
+// model.Boost). A row targets either a feed or a feed type, the other column
+// being empty, so the pair is the key. Expired rows are kept until deleted,
+// so that previewing another time (model.NOW_KEY) still sees them.
+const createFeedBoostTableSQL = `
+CREATE TABLE IF NOT EXISTS feed_boost (
+	feed_id character varying(64) NOT NULL DEFAULT '',
+	feed_type character varying(20) NOT NULL DEFAULT '',
+	factor double precision NOT NULL CHECK (factor >= 0),
+	expires_at timestamp with time zone,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	CONSTRAINT feed_boost_pkey PRIMARY KEY (feed_id, feed_type),
+	CONSTRAINT feed_boost_target_check CHECK ((feed_id = '') <> (feed_type = ''))
+)`
+
+// GetBoosts returns every stored boost, expired ones included, type boosts
+// first.
+func (f *store) GetBoosts(ctx context.Context) ([]model.Boost, error) {
+	boosts := []model.Boost{}
+	if err := f.db.SelectContext(ctx, &boosts,
+		`
+		SELECT feed_id, feed_type, factor, expires_at
+		FROM feed_boost
+		ORDER BY feed_id ASC, feed_type ASC
+		`,
+	); err != nil {
+		return nil, err
+	}
+	return boosts, nil
+}
+
+// SetBoost creates or replaces the boost of boost.FeedId or boost.FeedType.
+func (f *store) SetBoost(ctx context.Context, boost model.Boost) error {
+	if err := boost.Validate(); err != nil {
+		return err
+	}
+	_, err := f.db.ExecContext(ctx,
+		`
+		INSERT INTO feed_boost (feed_id, feed_type, factor, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (feed_id, feed_type)
+		DO UPDATE SET factor = EXCLUDED.factor, expires_at = EXCLUDED.expires_at
+		`,
+		boost.FeedId, boost.FeedType, boost.Factor, boost.ExpiresAt)
+	return err
+}
+
+// DeleteBoost deletes the boost of feedID, or of feedType when feedID is
+// empty. Returns sql.ErrNoRows when there is none.
+func (f *store) DeleteBoost(ctx context.Context, feedID string, feedType model.FeedType) error {
+	if feedID != "" {
+		feedType = ""
+	}
+	return f.execOne(ctx,
+		`DELETE FROM feed_boost WHERE feed_id = $1 AND feed_type = $2`,
+		feedID, feedType)
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/feed-sdk/model"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetBoosts(t *testing.T) {
+	ctx := context.Background()
+	expires := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	t.Run("success", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		rows := sqlmock.NewRows([]string{"feed_id", "feed_type", "factor", "expires_at"}).
+			AddRow("", "chat", 0.5, nil).
+			AddRow("feed1", "", 2.0, expires)
+		mock.ExpectQuery("SELECT feed_id, feed_type, factor, expires_at FROM feed_boost ORDER BY feed_id ASC, feed_type ASC").
+			WillReturnRows(rows)
+
+		boosts, err := store.GetBoosts(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(boosts) != 2 {
+			t.Fatalf("expected 2 boosts, got %d", len(boosts))
+		}
+		if boosts[0].FeedType != model.TypeChat || boosts[0].Factor != 0.5 || boosts[0].ExpiresAt != nil {
+			t.Errorf("unexpected type boost %+v", boosts[0])
+		}
+		if boosts[1].FeedId != "feed1" || boosts[1].Factor != 2 || boosts[1].ExpiresAt == nil || !boosts[1].ExpiresAt.Equal(expires) {
+			t.Errorf("unexpected feed boost %+v", boosts[1])
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery("SELECT feed_id, feed_type, factor, expires_at FROM feed_boost").WillReturnError(sqlmock.ErrCancelled)
+
+		if _, err := store.GetBoosts(ctx); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+}
+
+func TestSetBoost(t *testing.T) {
+	ctx := context.Background()
+	expires := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	t.Run("upsert", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("INSERT INTO feed_boost \\(feed_id, feed_type, factor, expires_at\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\) ON CONFLICT \\(feed_id, feed_type\\) DO UPDATE SET factor = EXCLUDED.factor, expires_at = EXCLUDED.expires_at").
+			WithArgs("feed1", model.FeedType(""), 2.0, &expires).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := store.SetBoost(ctx, model.Boost{FeedId: "feed1", Factor: 2, ExpiresAt: &expires}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	for name, boost := range map[string]model.Boost{
+		"no target":       {Factor: 2},
+		"both targets":    {FeedId: "feed1", FeedType: model.TypePost, Factor: 2},
+		"negative factor": {FeedType: model.TypePost, Factor: -1},
+		"NaN factor":      {FeedType: model.TypePost, Factor: math.NaN()},
+	} {
+		t.Run(name+" is rejected", func(t *testing.T) {
+			store, mock, cleanup := newMockStore(t)
+			defer cleanup()
+
+			if err := store.SetBoost(ctx, boost); err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeleteBoost(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		feedID   string
+		feedType model.FeedType
+		args     []any
+	}{
+		{name: "feed boost", feedID: "feed1", feedType: model.TypePost, args: []any{"feed1", model.FeedType("")}},
+		{name: "type boost", feedType: model.TypeChat, args: []any{"", model.TypeChat}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mock, cleanup := newMockStore(t)
+			defer cleanup()
+
+			mock.ExpectExec("DELETE FROM feed_boost WHERE feed_id = \\$1 AND feed_type = \\$2").
+				WithArgs(tt.args[0], tt.args[1]).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			if err := store.DeleteBoost(ctx, tt.feedID, tt.feedType); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+
+	t.Run("missing boost", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("DELETE FROM feed_boost").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := store.DeleteBoost(ctx, "feed1", ""); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+}
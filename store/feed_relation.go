@@ -2,7 +2,13 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 
+	"github.com/A-pen-app/feed-sdk/model"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
@@ -16,6 +22,90 @@ CREATE TABLE IF NOT EXISTS feed_relation (
 	CONSTRAINT feed_relation_related_feed_id_fkey FOREIGN KEY (related_feed_id) REFERENCES feed(feed_id) ON DELETE CASCADE
 )`
 
+// addRelationOrderColumnsSQL adds the columns that order a posts group: the
+// member with the highest priority is promoted first when the holder is
+// deleted, and weight breaks ties between equal priorities. Weight is also
+// the member's share under model.RotationWeightedRandom.
+const addRelationOrderColumnsSQL = `
+ALTER TABLE feed_relation
+	ADD COLUMN IF NOT EXISTS priority integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS weight double precision NOT NULL DEFAULT 1 CHECK (weight >= 0)
+`
+
+// selectPromotionCandidateSQL picks the relation member promoted into a posts
+// slot when its holder is deleted. feed_id breaks the remaining ties so both
+// delete paths agree on the same member.
+const selectPromotionCandidateSQL = `
+SELECT feed_id, policies
+FROM feed_relation
+WHERE related_feed_id = $1
+ORDER BY priority DESC, weight DESC, feed_id ASC
+LIMIT 1
+`
+
+// promotedSlot is the slot of a deleted posts holder, which the promoted
+// member takes over as is.
+type promotedSlot struct {
+	FeedType    model.FeedType `db:"feed_type"`
+	Position    int            `db:"position"`
+	MaxPosition *int           `db:"max_position"`
+	MinSpacing  int            `db:"min_spacing"`
+	Anchor      model.Anchor   `db:"anchor"`
+	Coldstart   bool           `db:"coldstart"`
+}
+
+// promotedSlotColumns selects a promotedSlot.
+const promotedSlotColumns = `feed_type, position, max_position, min_spacing, anchor, coldstart`
+
+// insertPromotedSQL pins the promoted member $1, with its relation policies
+// $4, in the slot of its deleted holder.
+const insertPromotedSQL = `
+INSERT INTO feed (feed_id, feed_type, position, policies, max_position, min_spacing, anchor, coldstart)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (feed_id) DO UPDATE SET
+	feed_type = EXCLUDED.feed_type,
+	position = EXCLUDED.position,
+	policies = EXCLUDED.policies,
+	max_position = EXCLUDED.max_position,
+	min_spacing = EXCLUDED.min_spacing,
+	anchor = EXCLUDED.anchor,
+	coldstart = EXCLUDED.coldstart
+`
+
+// addRelationPolicyFormatConstraintSQL attaches the validate_policies_format
+// function installed by addPolicyFormatConstraintSQL to feed_relation. Relation
+// policies are promoted into feed when the slot holder is deleted, so a policy
+// that feed would reject must be rejected here, at write time, rather than
+// failing the promotion transaction later.
+//
+// It only fires when policies are written: DeleteFeed re-points
+// related_feed_id on rows written before this trigger existed, and those must
+// not start failing. Use RepairRelationPolicies to find and clean them.
+const addRelationPolicyFormatConstraintSQL = `
+DO $$
+BEGIN
+	-- Drop existing trigger if it exists
+	DROP TRIGGER IF EXISTS relation_policies_format_trigger ON feed_relation;
+
+	-- Create the trigger
+	CREATE TRIGGER relation_policies_format_trigger
+		BEFORE INSERT OR UPDATE OF policies ON feed_relation
+		FOR EACH ROW
+		EXECUTE FUNCTION validate_policies_format();
+END $$;
+`
+
+// validatePolicies runs model.ValidatePolicy over every policy, so a bad
+// policy is reported with its reason before it reaches the trigger.
+func validatePolicies(policies []string) error {
+	for _, policy := range policies {
+		if err := model.ValidatePolicy(policy); err != nil {
+			return fmt.Errorf("invalid policy %q: %w", policy, err)
+		}
+	}
+	return nil
+}
+
 func (s *store) AddRelation(ctx context.Context, feedID, relatedFeedID string) error {
 	_, err := s.db.NamedExecContext(ctx,
 		`
@@ -44,6 +134,9 @@ func (s *store) RemoveRelation(ctx context.Context, feedID, relatedFeedID string
 }
 
 func (s *store) AddRelationWithPolicies(ctx context.Context, tx *sqlx.Tx, feedID, relatedFeedID string, policies pq.StringArray) error {
+	if err := validatePolicies(policies); err != nil {
+		return err
+	}
 	_, err := tx.NamedExecContext(ctx,
 		`
 		INSERT INTO feed_relation (feed_id, related_feed_id, policies)
@@ -69,3 +162,262 @@ func (s *store) GetRelatedFeeds(ctx context.Context, feedID string) ([]string, e
 		feedID)
 	return relatedFeedIDs, err
 }
+
+// SetRelationPriority sets the priority of feedID within the posts group held
+// by relatedFeedID. Returns sql.ErrNoRows when there is no such relation.
+func (s *store) SetRelationPriority(ctx context.Context, feedID, relatedFeedID string, priority int) error {
+	return s.updateRelation(ctx, "priority", priority, feedID, relatedFeedID)
+}
+
+// SetRelationWeight sets the weight of feedID within the posts group held by
+// relatedFeedID. Weights must not be negative. Returns sql.ErrNoRows when
+// there is no such relation.
+func (s *store) SetRelationWeight(ctx context.Context, feedID, relatedFeedID string, weight float64) error {
+	if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+		return fmt.Errorf("invalid relation weight %v", weight)
+	}
+	return s.updateRelation(ctx, "weight", weight, feedID, relatedFeedID)
+}
+
+// updateRelation sets a single column of a feed_relation row. column is never
+// user input.
+func (s *store) updateRelation(ctx context.Context, column string, value any, feedID, relatedFeedID string) error {
+	return s.execOne(ctx,
+		fmt.Sprintf(`UPDATE feed_relation SET %s = $1 WHERE feed_id = $2 AND related_feed_id = $3`, column),
+		value, feedID, relatedFeedID)
+}
+
+// SetRelationPolicies replaces the policies of feedID within the posts group
+// held by relatedFeedID. Returns sql.ErrNoRows when there is no such relation.
+func (s *store) SetRelationPolicies(ctx context.Context, feedID, relatedFeedID string, policies pq.StringArray) error {
+	if err := validatePolicies(policies); err != nil {
+		return err
+	}
+	if policies == nil {
+		policies = pq.StringArray{}
+	}
+	return s.updatePolicies(ctx, "feed_relation", setPoliciesExpr, policies,
+		"feed_id = $2 AND related_feed_id = $3", feedID, relatedFeedID)
+}
+
+// AddRelationPolicy appends policy to feedID within the posts group held by
+// relatedFeedID unless it is already there. Returns sql.ErrNoRows when there
+// is no such relation.
+func (s *store) AddRelationPolicy(ctx context.Context, feedID, relatedFeedID, policy string) error {
+	if err := validatePolicies([]string{policy}); err != nil {
+		return err
+	}
+	return s.updatePolicies(ctx, "feed_relation", addPolicyExpr, policy,
+		"feed_id = $2 AND related_feed_id = $3", feedID, relatedFeedID)
+}
+
+// RemoveRelationPolicy removes every occurrence of policy from feedID within
+// the posts group held by relatedFeedID. Returns sql.ErrNoRows when there is
+// no such relation.
+func (s *store) RemoveRelationPolicy(ctx context.Context, feedID, relatedFeedID, policy string) error {
+	return s.updatePolicies(ctx, "feed_relation", removePolicyExpr, policy,
+		"feed_id = $2 AND related_feed_id = $3", feedID, relatedFeedID)
+}
+
+// GetRelations returns every feed_relation row queued behind a posts slot,
+// grouped by holder and in promotion order within each group.
+func (s *store) GetRelations(ctx context.Context) ([]model.Relation, error) {
+	relations := []model.Relation{}
+	if err := s.db.SelectContext(ctx, &relations,
+		`
+		SELECT
+			feed_relation.feed_id,
+			feed_relation.related_feed_id,
+			feed_relation.policies,
+			feed_relation.priority,
+			feed_relation.weight
+		FROM
+			feed_relation
+		JOIN
+			feed ON feed.feed_id = feed_relation.related_feed_id
+		WHERE
+			feed.feed_type = $1
+		ORDER BY
+			feed_relation.related_feed_id ASC,
+			feed_relation.priority DESC,
+			feed_relation.weight DESC,
+			feed_relation.feed_id ASC
+		`,
+		model.TypePosts,
+	); err != nil {
+		return nil, err
+	}
+	return relations, nil
+}
+
+// GetGroups returns every pinned slot, by position, with the members queued
+// behind it.
+func (s *store) GetGroups(ctx context.Context) ([]model.Group, error) {
+	return s.selectGroups(ctx, "")
+}
+
+// GetGroup returns the slot held by holderID with its members. Returns
+// sql.ErrNoRows when holderID is not pinned.
+func (s *store) GetGroup(ctx context.Context, holderID string) (*model.Group, error) {
+	groups, err := s.selectGroups(ctx, "WHERE feed.feed_id = $1", holderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &groups[0], nil
+}
+
+// GetGroupsByMember returns the slots feedID is queued under, with all their
+// members. Empty when feedID is not a relation member.
+func (s *store) GetGroupsByMember(ctx context.Context, feedID string) ([]model.Group, error) {
+	return s.selectGroups(ctx,
+		"WHERE feed.feed_id IN (SELECT related_feed_id FROM feed_relation WHERE feed_id = $1)",
+		feedID)
+}
+
+// selectGroups loads holders and their members in a single query and folds
+// the rows into groups. where filters holders and is never user input. Range
+// and end-anchored pins may share a position, so rows are ordered by holder
+// too to keep each group in one run.
+func (s *store) selectGroups(ctx context.Context, where string, args ...any) ([]model.Group, error) {
+	var rows []struct {
+		model.Policy
+		MemberID       sql.NullString  `db:"member_id"`
+		MemberPolicies pq.StringArray  `db:"member_policies"`
+		MemberPriority sql.NullInt64   `db:"member_priority"`
+		MemberWeight   sql.NullFloat64 `db:"member_weight"`
+	}
+	if err := s.db.SelectContext(ctx, &rows, fmt.Sprintf(`
+		SELECT
+			feed.feed_id,
+			feed.feed_type,
+			feed.position,
+			feed.policies,
+			feed.max_position,
+			feed.min_spacing,
+			feed.anchor,
+			feed.coldstart,
+			feed_relation.feed_id AS member_id,
+			feed_relation.policies AS member_policies,
+			feed_relation.priority AS member_priority,
+			feed_relation.weight AS member_weight
+		FROM
+			feed
+		LEFT JOIN
+			feed_relation ON feed_relation.related_feed_id = feed.feed_id
+		%s
+		ORDER BY
+			feed.position ASC,
+			feed.feed_id ASC,
+			feed_relation.priority DESC,
+			feed_relation.weight DESC,
+			feed_relation.feed_id ASC
+	`, where), args...); err != nil {
+		return nil, err
+	}
+
+	groups := []model.Group{}
+	for _, row := range rows {
+		if len(groups) == 0 || groups[len(groups)-1].Holder.FeedId != row.FeedId {
+			groups = append(groups, model.Group{Holder: row.Policy, Members: []model.Relation{}})
+		}
+		if !row.MemberID.Valid {
+			continue
+		}
+		group := &groups[len(groups)-1]
+		group.Members = append(group.Members, model.Relation{
+			FeedId:        row.MemberID.String,
+			RelatedFeedId: row.FeedId,
+			Policies:      row.MemberPolicies,
+			Priority:      int(row.MemberPriority.Int64),
+			Weight:        row.MemberWeight.Float64,
+		})
+	}
+	return groups, nil
+}
+
+// ErrPolicyKindsMismatch is returned by RepairRelationPolicies when the policy
+// kinds registered in this process are not those the policy format trigger
+// was built with.
+var ErrPolicyKindsMismatch = errors.New("registered policy kinds differ from the policy trigger's")
+
+// RepairRelationPolicies scans every feed_relation row for policies that fail
+// model.ValidatePolicy and returns them. Unless dryRun is set, the invalid
+// policies are also stripped from their rows, keeping the valid ones, so the
+// rows can be promoted into feed again.
+//
+// Validity depends on the policy kinds registered in this process, while the
+// trigger is shared by every process using the database. A process missing
+// the host's custom kinds would strip valid policies, so repairing fails with
+// ErrPolicyKindsMismatch unless the registered kinds are exactly those of the
+// trigger, which keeps every kind registered by a process running NewFeed.
+// Dry runs only report, and lock no rows.
+func (s *store) RepairRelationPolicies(ctx context.Context, dryRun bool) ([]model.InvalidPolicy, error) {
+	query := `SELECT feed_id, related_feed_id, policies FROM feed_relation ORDER BY related_feed_id, feed_id`
+	// dry runs read without locking, so that reporting does not block writers
+	var (
+		queryer sqlx.QueryerContext = s.db
+		tx      *sqlx.Tx
+	)
+	if !dryRun {
+		var err error
+		tx, err = s.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		var source string
+		if err := tx.GetContext(ctx, &source, selectPolicyTriggerSQL); err != nil {
+			return nil, fmt.Errorf("failed to read the policy trigger: %w", err)
+		}
+		if !strings.Contains(source, policyKindsPattern(model.PolicyKindNames())) {
+			return nil, ErrPolicyKindsMismatch
+		}
+		queryer, query = tx, query+" FOR UPDATE"
+	}
+
+	var rows []struct {
+		FeedID        string         `db:"feed_id"`
+		RelatedFeedID string         `db:"related_feed_id"`
+		Policies      pq.StringArray `db:"policies"`
+	}
+	if err := sqlx.SelectContext(ctx, queryer, &rows, query); err != nil {
+		return nil, err
+	}
+
+	invalid := []model.InvalidPolicy{}
+	for _, row := range rows {
+		valid := pq.StringArray{}
+		for _, policy := range row.Policies {
+			if err := model.ValidatePolicy(policy); err != nil {
+				invalid = append(invalid, model.InvalidPolicy{
+					FeedId:        row.FeedID,
+					RelatedFeedId: row.RelatedFeedID,
+					Policy:        policy,
+					Error:         err.Error(),
+				})
+				continue
+			}
+			valid = append(valid, policy)
+		}
+		if dryRun || len(valid) == len(row.Policies) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE feed_relation SET policies = $1 WHERE feed_id = $2 AND related_feed_id = $3`,
+			valid, row.FeedID, row.RelatedFeedID); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return invalid, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return invalid, nil
+}
@@ -2,9 +2,14 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/A-pen-app/feed-sdk/model"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 )
 
 func TestAddRelation(t *testing.T) {
@@ -219,3 +224,505 @@ func TestGetRelatedFeedsStore(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRelations(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns posts groups", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery("SELECT feed_relation.feed_id, .* FROM feed_relation JOIN feed .* ORDER BY feed_relation.related_feed_id ASC, feed_relation.priority DESC, feed_relation.weight DESC, feed_relation.feed_id ASC").
+			WithArgs(model.TypePosts).
+			WillReturnRows(sqlmock.NewRows([]string{"feed_id", "related_feed_id", "policies", "priority", "weight"}).
+				AddRow("member1", "holder1", pq.StringArray{"exposure:1000"}, 1, 2.5).
+				AddRow("member2", "holder1", pq.StringArray{}, 0, 1.0))
+
+		relations, err := store.GetRelations(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(relations) != 2 {
+			t.Fatalf("expected 2 relations, got %d", len(relations))
+		}
+		if relations[0].FeedId != "member1" || relations[0].RelatedFeedId != "holder1" || len(relations[0].Policies) != 1 ||
+			relations[0].Priority != 1 || relations[0].Weight != 2.5 {
+			t.Errorf("unexpected relation %+v", relations[0])
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery("SELECT feed_relation.feed_id").WillReturnError(sqlmock.ErrCancelled)
+
+		if _, err := store.GetRelations(ctx); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+}
+
+func TestAddRelationWithPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("valid policies are inserted", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO feed_relation").
+			WithArgs("feed123", "feed456", pq.StringArray{"exposure:1000"}).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		tx, err := store.db.BeginTxx(ctx, nil)
+		if err != nil {
+			t.Fatalf("failed to begin transaction: %v", err)
+		}
+		if err := store.AddRelationWithPolicies(ctx, tx, "feed123", "feed456", pq.StringArray{"exposure:1000"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("invalid policies are rejected before writing", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectBegin()
+
+		tx, err := store.db.BeginTxx(ctx, nil)
+		if err != nil {
+			t.Fatalf("failed to begin transaction: %v", err)
+		}
+		if err := store.AddRelationWithPolicies(ctx, tx, "feed123", "feed456", pq.StringArray{"exposure:1000", "exposure:lots"}); err == nil {
+			t.Fatal("expected error but got none")
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+}
+
+func TestRepairRelationPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"feed_id", "related_feed_id", "policies"}).
+			AddRow("member1", "holder1", pq.StringArray{"exposure:1000"}).
+			AddRow("member2", "holder1", pq.StringArray{"exposure:1000", "Exposure:5", "bogus:1"})
+	}
+	trigger := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"prosrc"}).AddRow(policyFormatConstraintSQL(model.PolicyKindNames()))
+	}
+
+	t.Run("dry run only reports", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery("SELECT feed_id, related_feed_id, policies FROM feed_relation ORDER BY related_feed_id, feed_id$").WillReturnRows(rows())
+
+		invalid, err := store.RepairRelationPolicies(ctx, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(invalid) != 2 {
+			t.Fatalf("expected 2 invalid policies, got %d", len(invalid))
+		}
+		if invalid[0].FeedId != "member2" || invalid[0].RelatedFeedId != "holder1" || invalid[0].Policy != "Exposure:5" || invalid[0].Error == "" {
+			t.Errorf("unexpected report %+v", invalid[0])
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("repair strips invalid policies", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT prosrc FROM pg_proc WHERE proname = 'validate_policies_format'").WillReturnRows(trigger())
+		mock.ExpectQuery("SELECT feed_id, related_feed_id, policies FROM feed_relation .* FOR UPDATE").WillReturnRows(rows())
+		mock.ExpectExec("UPDATE feed_relation SET policies").
+			WithArgs(pq.StringArray{"exposure:1000"}, "member2", "holder1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		invalid, err := store.RepairRelationPolicies(ctx, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(invalid) != 2 {
+			t.Fatalf("expected 2 invalid policies, got %d", len(invalid))
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT prosrc FROM pg_proc").WillReturnRows(trigger())
+		mock.ExpectQuery("SELECT feed_id, related_feed_id, policies FROM feed_relation").WillReturnError(sqlmock.ErrCancelled)
+		mock.ExpectRollback()
+
+		if _, err := store.RepairRelationPolicies(ctx, false); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT prosrc FROM pg_proc").WillReturnRows(trigger())
+		mock.ExpectQuery("SELECT feed_id, related_feed_id, policies FROM feed_relation").WillReturnRows(rows())
+		mock.ExpectExec("UPDATE feed_relation SET policies").WillReturnError(sqlmock.ErrCancelled)
+		mock.ExpectRollback()
+
+		if _, err := store.RepairRelationPolicies(ctx, false); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+}
+
+func TestRepairRelationPolicies_KindsMismatch(t *testing.T) {
+	ctx := context.Background()
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+
+	// the trigger was built by a process with a custom kind this one lacks
+	source := strings.Replace(policyFormatConstraintSQL(model.PolicyKindNames()), "'^(", "'^(custom|", 1)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT prosrc FROM pg_proc").
+		WillReturnRows(sqlmock.NewRows([]string{"prosrc"}).AddRow(source))
+	mock.ExpectRollback()
+
+	if _, err := store.RepairRelationPolicies(ctx, false); !errors.Is(err, ErrPolicyKindsMismatch) {
+		t.Fatalf("expected ErrPolicyKindsMismatch, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRelationPolicyFormatConstraint(t *testing.T) {
+	t.Run("reuses the feed validation function", func(t *testing.T) {
+		if !contains(addRelationPolicyFormatConstraintSQL, "EXECUTE FUNCTION validate_policies_format()") {
+			t.Error("relation trigger should execute validate_policies_format")
+		}
+	})
+
+	t.Run("only fires when policies are written", func(t *testing.T) {
+		// DeleteFeed re-points related_feed_id on legacy rows; that must not
+		// start failing on policies written before the trigger existed.
+		if !contains(addRelationPolicyFormatConstraintSQL, "BEFORE INSERT OR UPDATE OF policies ON feed_relation") {
+			t.Error("relation trigger should fire on INSERT OR UPDATE OF policies only")
+		}
+	})
+}
+
+func TestGetGroups(t *testing.T) {
+	ctx := context.Background()
+	columns := []string{"feed_id", "feed_type", "position", "policies", "member_id", "member_policies", "member_priority", "member_weight"}
+
+	t.Run("folds rows into groups", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery("SELECT feed.feed_id, .* FROM feed LEFT JOIN feed_relation ON feed_relation.related_feed_id = feed.feed_id ORDER BY feed.position ASC").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("banner", "banners", 0, pq.StringArray{}, nil, nil, nil, nil).
+				AddRow("holder", "posts", 1, pq.StringArray{"exposure:10"}, "member1", pq.StringArray{"istarget:student"}, 2, 1.0).
+				AddRow("holder", "posts", 1, pq.StringArray{"exposure:10"}, "member2", pq.StringArray{}, 0, 3.0))
+
+		groups, err := store.GetGroups(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(groups) != 2 {
+			t.Fatalf("expected 2 groups, got %d", len(groups))
+		}
+		if groups[0].Holder.FeedId != "banner" || len(groups[0].Members) != 0 {
+			t.Errorf("unexpected group %+v", groups[0])
+		}
+		holder := groups[1]
+		if holder.Holder.FeedId != "holder" || holder.Holder.FeedType != model.TypePosts || holder.Holder.Position != 1 || len(holder.Holder.Policies) != 1 {
+			t.Errorf("unexpected holder %+v", holder.Holder)
+		}
+		if len(holder.Members) != 2 {
+			t.Fatalf("expected 2 members, got %d", len(holder.Members))
+		}
+		if m := holder.Members[0]; m.FeedId != "member1" || m.RelatedFeedId != "holder" || m.Priority != 2 || m.Weight != 1 || len(m.Policies) != 1 {
+			t.Errorf("unexpected member %+v", m)
+		}
+		if m := holder.Members[1]; m.FeedId != "member2" || m.Weight != 3 {
+			t.Errorf("unexpected member %+v", m)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("holders sharing a position stay whole", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		columns := []string{"feed_id", "feed_type", "position", "policies", "max_position", "min_spacing", "anchor", "coldstart", "member_id", "member_policies", "member_priority", "member_weight"}
+		mock.ExpectQuery("ORDER BY feed.position ASC, feed.feed_id ASC, feed_relation.priority DESC").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("end", "posts", 0, pq.StringArray{}, nil, 0, "end", true, "member1", pq.StringArray{}, 1, 1.0).
+				AddRow("end", "posts", 0, pq.StringArray{}, nil, 0, "end", true, "member2", pq.StringArray{}, 0, 1.0).
+				AddRow("start", "posts", 0, pq.StringArray{}, 4, 1, "start", false, "member3", pq.StringArray{}, 2, 1.0))
+
+		groups, err := store.GetGroups(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(groups) != 2 || len(groups[0].Members) != 2 || len(groups[1].Members) != 1 {
+			t.Fatalf("unexpected groups %+v", groups)
+		}
+		if h := groups[0].Holder; h.Anchor != model.AnchorEnd || !h.Coldstart || h.MaxPosition != nil {
+			t.Errorf("unexpected holder %+v", h)
+		}
+		if h := groups[1].Holder; h.MaxPosition == nil || *h.MaxPosition != 4 || h.MinSpacing != 1 || h.Anchor != model.AnchorStart {
+			t.Errorf("unexpected holder %+v", h)
+		}
+	})
+
+	t.Run("one slot", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery("LEFT JOIN feed_relation .* WHERE feed.feed_id = \\$1").
+			WithArgs("holder").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("holder", "posts", 1, pq.StringArray{}, "member1", pq.StringArray{}, 0, 1.0))
+
+		group, err := store.GetGroup(ctx, "holder")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if group.Holder.FeedId != "holder" || len(group.Members) != 1 {
+			t.Errorf("unexpected group %+v", group)
+		}
+	})
+
+	t.Run("one slot not pinned", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery("WHERE feed.feed_id = \\$1").
+			WithArgs("member1").
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		if _, err := store.GetGroup(ctx, "member1"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("reverse lookup", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery("WHERE feed.feed_id IN \\(SELECT related_feed_id FROM feed_relation WHERE feed_id = \\$1\\)").
+			WithArgs("member1").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("holder", "posts", 1, pq.StringArray{}, "member1", pq.StringArray{}, 0, 1.0).
+				AddRow("holder", "posts", 1, pq.StringArray{}, "member2", pq.StringArray{}, 0, 1.0))
+
+		groups, err := store.GetGroupsByMember(ctx, "member1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(groups) != 1 || len(groups[0].Members) != 2 {
+			t.Errorf("unexpected groups %+v", groups)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectQuery("SELECT feed.feed_id").WillReturnError(sqlmock.ErrCancelled)
+
+		if _, err := store.GetGroups(ctx); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+}
+
+func TestSetRelationOrder(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("set priority", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed_relation SET priority = \\$1 WHERE feed_id = \\$2 AND related_feed_id = \\$3").
+			WithArgs(5, "member1", "holder1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := store.SetRelationPriority(ctx, "member1", "holder1", 5); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("set weight", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed_relation SET weight = \\$1 WHERE feed_id = \\$2 AND related_feed_id = \\$3").
+			WithArgs(2.5, "member1", "holder1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := store.SetRelationWeight(ctx, "member1", "holder1", 2.5); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("negative weight is rejected", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		if err := store.SetRelationWeight(ctx, "member1", "holder1", -1); err == nil {
+			t.Fatal("expected error but got none")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("missing relation", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed_relation SET priority").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := store.SetRelationPriority(ctx, "member1", "holder1", 1); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed_relation SET weight").WillReturnError(sqlmock.ErrCancelled)
+
+		if err := store.SetRelationWeight(ctx, "member1", "holder1", 1); err == nil {
+			t.Fatal("expected error but got none")
+		}
+	})
+}
+
+func TestPromotionOrder(t *testing.T) {
+	// DeleteFeed and DeleteFeedPosition must promote the same member
+	if !contains(selectPromotionCandidateSQL, "ORDER BY priority DESC, weight DESC, feed_id ASC") {
+		t.Error("promotion should order by priority, then weight, then feed_id")
+	}
+	if contains(selectPromotionCandidateSQL, "RANDOM()") {
+		t.Error("promotion should be deterministic")
+	}
+}
+
+func TestUpdateRelationPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("set policies", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed_relation SET policies = \\$1 WHERE feed_id = \\$2 AND related_feed_id = \\$3").
+			WithArgs(pq.StringArray{"exposure:1000"}, "member1", "holder1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := store.SetRelationPolicies(ctx, "member1", "holder1", pq.StringArray{"exposure:1000"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("add policy", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed_relation SET policies = CASE WHEN .* array_append.* WHERE feed_id = \\$2 AND related_feed_id = \\$3").
+			WithArgs("unexpose:1767225600", "member1", "holder1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := store.AddRelationPolicy(ctx, "member1", "holder1", "unexpose:1767225600"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("remove policy", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed_relation SET policies = array_remove.* WHERE feed_id = \\$2 AND related_feed_id = \\$3").
+			WithArgs("unexpose:1735689600", "member1", "holder1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := store.RemoveRelationPolicy(ctx, "member1", "holder1", "unexpose:1735689600"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("invalid policies are rejected before writing", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		if err := store.SetRelationPolicies(ctx, "member1", "holder1", pq.StringArray{"Exposure:5"}); err == nil {
+			t.Fatal("expected error but got none")
+		}
+		if err := store.AddRelationPolicy(ctx, "member1", "holder1", "bogus:1"); err == nil {
+			t.Fatal("expected error but got none")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("missing relation", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed_relation SET policies").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := store.RemoveRelationPolicy(ctx, "member1", "holder1", "exposure:1000"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+}
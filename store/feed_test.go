@@ -3,7 +3,13 @@ package store
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/A-pen-app/feed-sdk/model"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -19,11 +25,17 @@ func newMockStore(t *testing.T) (*store, sqlmock.Sqlmock, func()) {
 
 	mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_coldstart").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT prosrc FROM pg_proc").WillReturnRows(sqlmock.NewRows([]string{"prosrc"}))
 	mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_relation").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0)) // addRelationPolicyFormatConstraintSQL
+	mock.ExpectExec("ALTER TABLE feed_relation ADD COLUMN IF NOT EXISTS priority").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_changelog").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0)) // widenPolicyColumnsSQL
 	mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0)) // createFeedChangelogTriggerSQL
+	mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0)) // addPositionRangeColumnsSQL
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_boost").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE feed ADD COLUMN IF NOT EXISTS coldstart").WillReturnResult(sqlmock.NewResult(0, 0))
 
 	sqlxDB := sqlx.NewDb(db, "postgres")
 	s := NewFeed(sqlxDB)
@@ -50,11 +62,17 @@ func TestNewFeed(t *testing.T) {
 
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_coldstart").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT prosrc FROM pg_proc").WillReturnRows(sqlmock.NewRows([]string{"prosrc"}))
 		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_relation").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0)) // addRelationPolicyFormatConstraintSQL
+		mock.ExpectExec("ALTER TABLE feed_relation ADD COLUMN IF NOT EXISTS priority").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_changelog").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0)) // widenPolicyColumnsSQL
 		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0)) // createFeedChangelogTriggerSQL
+		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0)) // addPositionRangeColumnsSQL
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_boost").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ALTER TABLE feed ADD COLUMN IF NOT EXISTS coldstart").WillReturnResult(sqlmock.NewResult(0, 0))
 
 		sqlxDB := sqlx.NewDb(db, "postgres")
 		store := NewFeed(sqlxDB)
@@ -193,6 +211,7 @@ func TestPatchFeed(t *testing.T) {
 		feedType      model.FeedType
 		position      int
 		mockError     error
+		rangeExceeded bool
 		expectedError bool
 	}{
 		{
@@ -221,6 +240,14 @@ func TestPatchFeed(t *testing.T) {
 			feedType: model.TypePost,
 			position: 0,
 		},
+		{
+			name:          "past the max position of a range pin",
+			feedID:        "feed123",
+			feedType:      model.TypePost,
+			position:      9,
+			rangeExceeded: true,
+			expectedError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -233,9 +260,14 @@ func TestPatchFeed(t *testing.T) {
 			// The parameters appear twice: once for INSERT, once for UPDATE clause.
 			if tt.mockError != nil {
 				mock.ExpectExec("INSERT INTO feed").WillReturnError(tt.mockError)
+			} else if tt.rangeExceeded {
+				// the conflict update is skipped by its max_position guard
+				mock.ExpectExec("INSERT INTO feed(.|\\n)*WHERE\\s+feed.max_position IS NULL OR feed.max_position >= \\$6").
+					WithArgs(tt.feedID, tt.feedType, tt.position, tt.feedType, tt.position, tt.position).
+					WillReturnResult(sqlmock.NewResult(0, 0))
 			} else {
 				mock.ExpectExec("INSERT INTO feed").
-					WithArgs(tt.feedID, tt.feedType, tt.position, tt.feedType, tt.position).
+					WithArgs(tt.feedID, tt.feedType, tt.position, tt.feedType, tt.position, tt.position).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			}
 
@@ -245,6 +277,9 @@ func TestPatchFeed(t *testing.T) {
 				if err == nil {
 					t.Fatal("expected error but got none")
 				}
+				if tt.rangeExceeded && !errors.Is(err, ErrInvalidPositionRange) {
+					t.Errorf("expected ErrInvalidPositionRange, got %v", err)
+				}
 				return
 			}
 
@@ -284,7 +319,7 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("nonexistent").
 			WillReturnError(sql.ErrNoRows)
 		mock.ExpectExec("DELETE FROM feed").
@@ -307,7 +342,7 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("feed123").
 			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
 				AddRow("banners", 3))
@@ -331,7 +366,7 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("feed123").
 			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
 				AddRow("posts", 5))
@@ -359,10 +394,10 @@ func TestDeleteFeed(t *testing.T) {
 
 		mock.ExpectBegin()
 		// 1. Get the feed being deleted
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("source_id").
-			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
-				AddRow("posts", 5))
+			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position", "max_position", "min_spacing", "anchor", "coldstart"}).
+				AddRow("posts", 5, nil, 0, "start", false))
 		// 2. Find a replacement candidate
 		mock.ExpectQuery("SELECT feed_id, policies FROM feed_relation").
 			WithArgs("source_id").
@@ -382,7 +417,7 @@ func TestDeleteFeed(t *testing.T) {
 			WillReturnResult(sqlmock.NewResult(0, 1))
 		// 6. Insert the replacement at the same position
 		mock.ExpectExec("INSERT INTO feed").
-			WithArgs("replacement_id", model.TypePosts, 5, pq.StringArray{"exposure:1000"}).
+			WithArgs("replacement_id", model.TypePosts, 5, pq.StringArray{"exposure:1000"}, nil, 0, model.AnchorStart, false).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
@@ -401,10 +436,10 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("source_id").
-			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
-				AddRow("posts", 0))
+			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position", "max_position", "min_spacing", "anchor", "coldstart"}).
+				AddRow("posts", 0, nil, 0, "start", false))
 		mock.ExpectQuery("SELECT feed_id, policies FROM feed_relation").
 			WithArgs("source_id").
 			WillReturnRows(sqlmock.NewRows([]string{"feed_id", "policies"}).
@@ -419,7 +454,7 @@ func TestDeleteFeed(t *testing.T) {
 			WithArgs("source_id").
 			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectExec("INSERT INTO feed").
-			WithArgs("replacement_id", model.TypePosts, 0, pq.StringArray{}).
+			WithArgs("replacement_id", model.TypePosts, 0, pq.StringArray{}, nil, 0, model.AnchorStart, false).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
@@ -433,12 +468,84 @@ func TestDeleteFeed(t *testing.T) {
 		}
 	})
 
+	slots := []struct {
+		name        string
+		position    int
+		maxPosition any
+		minSpacing  int
+		anchor      model.Anchor
+		coldstart   bool
+	}{
+		{name: "range holder", position: 3, maxPosition: 6, minSpacing: 1, anchor: model.AnchorStart},
+		{name: "end-anchored holder", position: 0, anchor: model.AnchorEnd},
+		{name: "coldstart holder", position: 2, anchor: model.AnchorStart, coldstart: true},
+	}
+	for _, slot := range slots {
+		t.Run("promotion keeps the slot of a "+slot.name, func(t *testing.T) {
+			store, mock, cleanup := newMockStore(t)
+			defer cleanup()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
+				WithArgs("source_id").
+				WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position", "max_position", "min_spacing", "anchor", "coldstart"}).
+					AddRow("posts", slot.position, slot.maxPosition, slot.minSpacing, string(slot.anchor), slot.coldstart))
+			mock.ExpectQuery("SELECT feed_id, policies FROM feed_relation").
+				WithArgs("source_id").
+				WillReturnRows(sqlmock.NewRows([]string{"feed_id", "policies"}).
+					AddRow("replacement_id", pq.StringArray{}))
+			mock.ExpectExec("DELETE FROM feed_relation").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE feed_relation SET related_feed_id").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("DELETE FROM feed").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO feed \\(feed_id, feed_type, position, policies, max_position, min_spacing, anchor, coldstart\\)(.+)max_position = EXCLUDED.max_position,(.+)min_spacing = EXCLUDED.min_spacing,(.+)anchor = EXCLUDED.anchor,(.+)coldstart = EXCLUDED.coldstart").
+				WithArgs("replacement_id", model.TypePosts, slot.position, pq.StringArray{}, slot.maxPosition, slot.minSpacing, slot.anchor, slot.coldstart).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			if err := store.DeleteFeed(ctx, "source_id"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+
+		t.Run("position delete keeps the slot of a "+slot.name, func(t *testing.T) {
+			store, mock, cleanup := newMockStore(t)
+			defer cleanup()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed WHERE feed_id = \\$1 AND position = \\$2").
+				WithArgs("source_id", slot.position).
+				WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position", "max_position", "min_spacing", "anchor", "coldstart"}).
+					AddRow("posts", slot.position, slot.maxPosition, slot.minSpacing, string(slot.anchor), slot.coldstart))
+			mock.ExpectQuery("SELECT feed_id, policies FROM feed_relation").
+				WithArgs("source_id").
+				WillReturnRows(sqlmock.NewRows([]string{"feed_id", "policies"}).
+					AddRow("replacement_id", pq.StringArray{}))
+			mock.ExpectExec("DELETE FROM feed_relation").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE feed_relation SET related_feed_id").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("DELETE FROM feed").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO feed").
+				WithArgs("replacement_id", model.TypePosts, slot.position, pq.StringArray{}, slot.maxPosition, slot.minSpacing, slot.anchor, slot.coldstart).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			if err := store.DeleteFeedPosition(ctx, "source_id", slot.position); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+
 	t.Run("error on delete relation row during promotion", func(t *testing.T) {
 		store, mock, cleanup := newMockStore(t)
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("source_id").
 			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
 				AddRow("posts", 5))
@@ -465,7 +572,7 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("source_id").
 			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
 				AddRow("posts", 5))
@@ -495,7 +602,7 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("source_id").
 			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
 				AddRow("posts", 5))
@@ -528,7 +635,7 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("source_id").
 			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
 				AddRow("posts", 5))
@@ -564,7 +671,7 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("feed123").
 			WillReturnError(sql.ErrNoRows)
 		mock.ExpectExec("DELETE FROM feed").
@@ -587,7 +694,7 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("feed123").
 			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
 				AddRow("banners", 3))
@@ -611,7 +718,7 @@ func TestDeleteFeed(t *testing.T) {
 		defer cleanup()
 
 		mock.ExpectBegin()
-		mock.ExpectQuery("SELECT feed_type, position FROM feed").
+		mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed").
 			WithArgs("feed123").
 			WillReturnRows(sqlmock.NewRows([]string{"feed_type", "position"}).
 				AddRow("posts", 5))
@@ -634,6 +741,90 @@ func TestDeleteFeed(t *testing.T) {
 	})
 }
 
+func TestAddGroupMember(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("post holder becomes a posts group", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT feed_type FROM feed WHERE feed_id = \\$1 FOR UPDATE").
+			WithArgs("holder").
+			WillReturnRows(sqlmock.NewRows([]string{"feed_type"}).AddRow("post"))
+		mock.ExpectExec("INSERT INTO feed_relation").
+			WithArgs("member", "holder", pq.StringArray{"exposure:1000"}).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE feed SET feed_type = \\$1 WHERE feed_id = \\$2").
+			WithArgs(model.TypePosts, "holder").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := store.AddGroupMember(ctx, "member", "holder", pq.StringArray{"exposure:1000"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("banner holder is rejected", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT feed_type FROM feed").
+			WillReturnRows(sqlmock.NewRows([]string{"feed_type"}).AddRow("banners"))
+		mock.ExpectRollback()
+
+		if err := store.AddGroupMember(ctx, "member", "holder", nil); err == nil {
+			t.Fatal("expected error but got none")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("holder not pinned", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT feed_type FROM feed").WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		if err := store.AddGroupMember(ctx, "member", "holder", nil); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+}
+
+func TestDeleteFeedPositionMember(t *testing.T) {
+	ctx := context.Background()
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+
+	// the member leaves the group at position 0, which may be end-anchored
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT feed_type, position, max_position, min_spacing, anchor, coldstart FROM feed WHERE feed_id = \\$1 AND position = \\$2").
+		WithArgs("member", 0).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT feed_id FROM feed WHERE position = \\$1 AND feed_id IN \\(SELECT related_feed_id FROM feed_relation WHERE feed_id = \\$2\\)").
+		WithArgs(0, "member").
+		WillReturnRows(sqlmock.NewRows([]string{"feed_id"}).AddRow("end_holder"))
+	mock.ExpectExec("DELETE FROM feed_relation WHERE feed_id = \\$1 AND related_feed_id = \\$2").
+		WithArgs("member", "end_holder").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := store.DeleteFeedPosition(ctx, "member", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
 func TestGetPoliciesOrderBy(t *testing.T) {
 	ctx := context.Background()
 	store, mock, cleanup := newMockStore(t)
@@ -689,10 +880,15 @@ func TestFeedChangelogTableCreation(t *testing.T) {
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed").WillReturnResult(sqlmock.NewResult(0, 0))
 		// Coldstart table creation succeeds
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_coldstart").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT prosrc FROM pg_proc").WillReturnRows(sqlmock.NewRows([]string{"prosrc"}))
 		// Policy format constraint succeeds
 		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0))
 		// Feed relation table creation succeeds
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_relation").WillReturnResult(sqlmock.NewResult(0, 0))
+		// Relation policy format constraint succeeds
+		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0))
+		// Relation order columns are added
+		mock.ExpectExec("ALTER TABLE feed_relation ADD COLUMN IF NOT EXISTS priority").WillReturnResult(sqlmock.NewResult(0, 0))
 		// Changelog table creation fails
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_changelog").WillReturnError(sqlmock.ErrCancelled)
 
@@ -722,10 +918,15 @@ func TestFeedChangelogTableCreation(t *testing.T) {
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed").WillReturnResult(sqlmock.NewResult(0, 0))
 		// Coldstart table creation succeeds
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_coldstart").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT prosrc FROM pg_proc").WillReturnRows(sqlmock.NewRows([]string{"prosrc"}))
 		// Policy format constraint succeeds
 		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0))
 		// Feed relation table creation succeeds
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_relation").WillReturnResult(sqlmock.NewResult(0, 0))
+		// Relation policy format constraint succeeds
+		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0))
+		// Relation order columns are added
+		mock.ExpectExec("ALTER TABLE feed_relation ADD COLUMN IF NOT EXISTS priority").WillReturnResult(sqlmock.NewResult(0, 0))
 		// Changelog table creation succeeds
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_changelog").WillReturnResult(sqlmock.NewResult(0, 0))
 		// Widening the policy columns succeeds
@@ -757,8 +958,11 @@ func TestFeedChangelogTableCreation(t *testing.T) {
 
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_coldstart").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT prosrc FROM pg_proc").WillReturnRows(sqlmock.NewRows([]string{"prosrc"}))
 		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_relation").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DO \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0)) // addRelationPolicyFormatConstraintSQL
+		mock.ExpectExec("ALTER TABLE feed_relation ADD COLUMN IF NOT EXISTS priority").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_changelog").WillReturnResult(sqlmock.NewResult(0, 0))
 		// Widening fails
 		mock.ExpectExec("DO \\$\\$").WillReturnError(sqlmock.ErrCancelled)
@@ -966,3 +1170,372 @@ func searchString(s, substr string) bool {
 	}
 	return false
 }
+
+func TestPolicyFormatConstraint(t *testing.T) {
+	t.Run("atom pattern covers every policy type", func(t *testing.T) {
+		sql := policyFormatConstraintSQL(model.PolicyKindNames())
+		for _, policy := range []model.PolicyType{
+			model.Exposure, model.Inexpose, model.Unexpose, model.Istarget, model.IsTheOne,
+			model.After, model.Cooldown, model.MinCTR, model.Dismissed,
+			model.Platform, model.MinVersion, model.MaxVersion,
+		} {
+			if !contains(sql, "|"+policy.String()+"|") &&
+				!contains(sql, "("+policy.String()+"|") &&
+				!contains(sql, "|"+policy.String()+")") {
+				t.Errorf("policy format constraint does not accept %s", policy)
+			}
+		}
+		if contains(sql, "{{policy_kinds}}") {
+			t.Error("policy kinds placeholder was not rendered")
+		}
+	})
+
+	t.Run("atom pattern covers registered kinds", func(t *testing.T) {
+		// the registry is process-wide, so every run registers a new kind
+		name := fmt.Sprintf("store_test_kind_%d", time.Now().UnixNano())
+		if err := model.RegisterPolicyKind(model.PolicyKind{
+			Name: name,
+			Evaluate: func(ctx context.Context, in model.PolicyInput) (bool, error) {
+				return false, nil
+			},
+		}); err != nil {
+			t.Fatalf("failed to register policy kind: %v", err)
+		}
+		if !contains(policyFormatConstraintSQL(model.PolicyKindNames()), "|"+name+"|") && !contains(policyFormatConstraintSQL(model.PolicyKindNames()), "|"+name+")") {
+			t.Error("policy format constraint does not accept the registered kind")
+		}
+	})
+
+	t.Run("keeps the kinds of the installed trigger", func(t *testing.T) {
+		installed := strings.Replace(policyFormatConstraintSQL(model.PolicyKindNames()), "'^(", "'^(host_kind|", 1)
+		kinds := triggerPolicyKinds(installed)
+		if !slices.Contains(kinds, "host_kind") || !slices.Contains(kinds, "exposure") || !slices.IsSorted(kinds) {
+			t.Errorf("expected the registered and installed kinds, sorted, got %v", kinds)
+		}
+		if got := triggerPolicyKinds(""); !slices.Equal(got, model.PolicyKindNames()) {
+			t.Errorf("expected the registered kinds without a trigger, got %v", got)
+		}
+		// triggers from before the registry listed their kinds inline
+		legacy := "IF p !~ '^(exposure|legacy_kind):[a-z0-9:_-]+$' THEN"
+		if !slices.Contains(triggerPolicyKinds(legacy), "legacy_kind") {
+			t.Error("expected the kinds of a legacy trigger to be kept")
+		}
+	})
+
+	t.Run("NewFeed installs the merged kinds", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock db: %v", err)
+		}
+		defer db.Close()
+
+		installed := strings.Replace(policyFormatConstraintSQL(model.PolicyKindNames()), "'^(", "'^(host_kind|", 1)
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_coldstart").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT prosrc FROM pg_proc").WillReturnRows(sqlmock.NewRows([]string{"prosrc"}).AddRow(installed))
+		mock.ExpectExec("DO \\$\\$(.|\\n)*'\\^\\(([a-z0-9_]+\\|)*host_kind\\|").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS feed_relation").WillReturnError(sqlmock.ErrCancelled)
+
+		func() {
+			defer func() { recover() }()
+			NewFeed(sqlx.NewDb(db, "postgres"))
+		}()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("accepts boolean expressions", func(t *testing.T) {
+		if !contains(addPolicyFormatConstraintSQL, "IF p ~ '^expr:' THEN") {
+			t.Error("policy format constraint should branch on expr: policies")
+		}
+		if !contains(addPolicyFormatConstraintSQL, "token NOT IN ('and', 'or', 'not', '(', ')') AND token !~ atom_pattern") {
+			t.Error("policy format constraint should validate every expression token")
+		}
+	})
+}
+
+func TestUpdatePolicies(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		run           func(s *store) error
+		expectQuery   string
+		expectArgs    []driver.Value
+		rowsAffected  int64
+		mockError     error
+		expectNoExec  bool
+		expectedError error
+		expectAnyErr  bool
+	}{
+		{
+			name:         "set policies",
+			run:          func(s *store) error { return s.SetPolicies(ctx, "feed123", pq.StringArray{"unexpose:1767225600"}) },
+			expectQuery:  "UPDATE feed SET policies = \\$1 WHERE feed_id = \\$2",
+			expectArgs:   []driver.Value{pq.StringArray{"unexpose:1767225600"}, "feed123"},
+			rowsAffected: 1,
+		},
+		{
+			name:         "set no policies clears them",
+			run:          func(s *store) error { return s.SetPolicies(ctx, "feed123", nil) },
+			expectQuery:  "UPDATE feed SET policies = \\$1 WHERE feed_id = \\$2",
+			expectArgs:   []driver.Value{pq.StringArray{}, "feed123"},
+			rowsAffected: 1,
+		},
+		{
+			name:         "set invalid policies",
+			run:          func(s *store) error { return s.SetPolicies(ctx, "feed123", pq.StringArray{"exposure:many"}) },
+			expectNoExec: true,
+			expectAnyErr: true,
+		},
+		{
+			name:         "add policy",
+			run:          func(s *store) error { return s.AddPolicy(ctx, "feed123", "exposure:1000") },
+			expectQuery:  "UPDATE feed SET policies = CASE WHEN \\$1::text = ANY\\(policies\\) THEN policies ELSE array_append\\(policies, \\$1::text\\) END WHERE feed_id = \\$2",
+			expectArgs:   []driver.Value{"exposure:1000", "feed123"},
+			rowsAffected: 1,
+		},
+		{
+			name:         "add invalid policy",
+			run:          func(s *store) error { return s.AddPolicy(ctx, "feed123", "bogus:1") },
+			expectNoExec: true,
+			expectAnyErr: true,
+		},
+		{
+			name:         "remove policy",
+			run:          func(s *store) error { return s.RemovePolicy(ctx, "feed123", "exposure:1000") },
+			expectQuery:  "UPDATE feed SET policies = array_remove\\(policies, \\$1::text\\) WHERE feed_id = \\$2",
+			expectArgs:   []driver.Value{"exposure:1000", "feed123"},
+			rowsAffected: 1,
+		},
+		{
+			name:          "feed not pinned",
+			run:           func(s *store) error { return s.AddPolicy(ctx, "feed123", "exposure:1000") },
+			expectQuery:   "UPDATE feed SET policies",
+			expectArgs:    []driver.Value{"exposure:1000", "feed123"},
+			expectedError: sql.ErrNoRows,
+		},
+		{
+			name:         "database error",
+			run:          func(s *store) error { return s.RemovePolicy(ctx, "feed123", "exposure:1000") },
+			expectQuery:  "UPDATE feed SET policies",
+			mockError:    sqlmock.ErrCancelled,
+			expectAnyErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mock, cleanup := newMockStore(t)
+			defer cleanup()
+
+			if !tt.expectNoExec {
+				exec := mock.ExpectExec(tt.expectQuery)
+				if tt.expectArgs != nil {
+					exec = exec.WithArgs(tt.expectArgs...)
+				}
+				if tt.mockError != nil {
+					exec.WillReturnError(tt.mockError)
+				} else {
+					exec.WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+				}
+			}
+
+			err := tt.run(store)
+			switch {
+			case tt.expectedError != nil:
+				if !errors.Is(err, tt.expectedError) {
+					t.Fatalf("expected %v, got %v", tt.expectedError, err)
+				}
+			case tt.expectAnyErr:
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetPositionRange(t *testing.T) {
+	ctx := context.Background()
+	maxPosition := 6
+	beforePosition := 2
+
+	tests := []struct {
+		name          string
+		maxPosition   *int
+		minSpacing    int
+		anchor        model.Anchor
+		pinned        bool
+		expectedArgs  []driver.Value
+		expectNoQuery bool
+		invalidRange  bool
+		expectedError bool
+	}{
+		{
+			name:         "range pin",
+			maxPosition:  &maxPosition,
+			minSpacing:   1,
+			anchor:       model.AnchorStart,
+			pinned:       true,
+			expectedArgs: []driver.Value{int64(6), int64(1), "start", "feed123"},
+		},
+		{
+			name:         "back to an exact pin, empty anchor means start",
+			pinned:       true,
+			expectedArgs: []driver.Value{nil, int64(0), "start", "feed123"},
+		},
+		{
+			name:         "end anchor",
+			anchor:       model.AnchorEnd,
+			pinned:       true,
+			expectedArgs: []driver.Value{nil, int64(0), "end", "feed123"},
+		},
+		{
+			name:          "feed not pinned",
+			expectedError: true,
+		},
+		{
+			name:          "max position before the position",
+			maxPosition:   &beforePosition,
+			pinned:        true,
+			invalidRange:  true,
+			expectedError: true,
+		},
+		{
+			name:          "negative spacing",
+			minSpacing:    -1,
+			expectNoQuery: true,
+			invalidRange:  true,
+			expectedError: true,
+		},
+		{
+			name:          "unknown anchor",
+			anchor:        model.Anchor("middle"),
+			expectNoQuery: true,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mock, cleanup := newMockStore(t)
+			defer cleanup()
+
+			if !tt.expectNoQuery {
+				mock.ExpectBegin()
+				rows := sqlmock.NewRows([]string{"position"})
+				if tt.pinned {
+					rows.AddRow(4)
+				}
+				mock.ExpectQuery("SELECT position FROM feed WHERE feed_id = \\$1 FOR UPDATE").
+					WithArgs("feed123").
+					WillReturnRows(rows)
+				if tt.expectedArgs != nil {
+					mock.ExpectExec("UPDATE feed SET max_position = \\$1, min_spacing = \\$2, anchor = \\$3 WHERE feed_id = \\$4").
+						WithArgs(tt.expectedArgs...).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			err := store.SetPositionRange(ctx, "feed123", tt.maxPosition, tt.minSpacing, tt.anchor)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				if tt.invalidRange && !errors.Is(err, ErrInvalidPositionRange) {
+					t.Errorf("expected ErrInvalidPositionRange, got %v", err)
+				}
+				if !tt.pinned && !tt.expectNoQuery && !errors.Is(err, sql.ErrNoRows) {
+					t.Errorf("expected sql.ErrNoRows, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetPoliciesRangeColumns(t *testing.T) {
+	ctx := context.Background()
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+
+	mock.ExpectQuery("SELECT (.+)feed.max_position,(.+)feed.min_spacing,(.+)feed.anchor,(.+)feed.coldstart FROM").
+		WillReturnRows(sqlmock.NewRows([]string{"feed_id", "feed_type", "position", "policies", "max_position", "min_spacing", "anchor", "coldstart"}).
+			AddRow("feed1", "post", 0, pq.StringArray{}, nil, 0, "start", false).
+			AddRow("feed2", "post", 3, pq.StringArray{}, 6, 1, "end", true))
+
+	policies, err := store.GetPolicies(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policies[0].MaxPosition != nil || policies[0].Anchor != model.AnchorStart {
+		t.Errorf("unexpected exact pin %+v", policies[0])
+	}
+	if policies[1].MaxPosition == nil || *policies[1].MaxPosition != 6 || policies[1].MinSpacing != 1 || policies[1].Anchor != model.AnchorEnd {
+		t.Errorf("unexpected range pin %+v", policies[1])
+	}
+	if policies[0].Coldstart || !policies[1].Coldstart {
+		t.Errorf("unexpected coldstart flags %v, %v", policies[0].Coldstart, policies[1].Coldstart)
+	}
+}
+
+func TestSetPinColdstart(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed SET coldstart = \\$1 WHERE feed_id = \\$2").
+			WithArgs(true, "feed1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := store.SetPinColdstart(ctx, "feed1", true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("not pinned", func(t *testing.T) {
+		store, mock, cleanup := newMockStore(t)
+		defer cleanup()
+
+		mock.ExpectExec("UPDATE feed SET coldstart").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := store.SetPinColdstart(ctx, "feed1", false); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+}
+
+func TestPositionRangeMigration(t *testing.T) {
+	for _, fragment := range []string{
+		"ADD COLUMN IF NOT EXISTS max_position integer",
+		"ADD COLUMN IF NOT EXISTS min_spacing integer NOT NULL DEFAULT 0",
+		"ADD COLUMN IF NOT EXISTS anchor character varying(10) NOT NULL DEFAULT 'start'",
+		"DROP CONSTRAINT IF EXISTS feed_position_position1_key",
+		"ON feed (anchor, position) WHERE max_position IS NULL",
+	} {
+		if !contains(addPositionRangeColumnsSQL, fragment) {
+			t.Errorf("position range migration missing %q", fragment)
+		}
+	}
+}